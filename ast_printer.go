@@ -78,6 +78,14 @@ func (a *AstPrinter) visitCallExpr(c *Call) interface{} {
 	}
 }
 
+func (a *AstPrinter) visitMacroCallExpr(m *MacroCall) interface{} {
+	return Node{
+		"_type":     "MacroCallExpression",
+		"callee":    m.name.lexeme,
+		"arguments": a.resolve(m.arguments),
+	}
+}
+
 func (a *AstPrinter) visitVariableExpr(v *Variable) interface{} {
 	// for superclass
 	if v.name == (Token{}) {
@@ -89,6 +97,13 @@ func (a *AstPrinter) visitVariableExpr(v *Variable) interface{} {
 	}
 }
 
+func (a *AstPrinter) visitAwaitExpr(e *Await) interface{} {
+	return Node{
+		"_type":    "AwaitExpression",
+		"argument": a.resolveExpr(e.value),
+	}
+}
+
 func (a *AstPrinter) visitAssignExpr(e *Assign) interface{} {
 	return Node{
 		"_type": "AssignmentExpression",
@@ -120,6 +135,16 @@ func (a *AstPrinter) visitGetExpr(g *Get) interface{} {
 	}
 }
 
+func (a *AstPrinter) visitSliceExpr(s *Slice) interface{} {
+	return Node{
+		"_type":  "SliceExpression",
+		"object": a.resolveExpr(s.object),
+		"start":  a.resolveExpr(s.start),
+		"stop":   a.resolveExpr(s.stop),
+		"step":   a.resolveExpr(s.step),
+	}
+}
+
 func (a *AstPrinter) visitSetExpr(s *Set) interface{} {
 	return Node{
 		"_type": "SetExpression",
@@ -163,6 +188,12 @@ func (a *AstPrinter) visitBlockStmt(stmt *Block) interface{} {
 }
 
 func (a *AstPrinter) visitClassStmt(stmt *Class) interface{} {
+	var fields []interface{}
+
+	for _, field := range stmt.fields {
+		fields = append(fields, a.resolveStmt(&field))
+	}
+
 	var methods []interface{}
 
 	for _, method := range stmt.methods {
@@ -173,14 +204,114 @@ func (a *AstPrinter) visitClassStmt(stmt *Class) interface{} {
 		methods = append(methods, a.resolveFunction(method, kind))
 	}
 
+	for _, getter := range stmt.getters {
+		methods = append(methods, a.resolveFunction(getter, GETTER))
+	}
+
+	for _, setter := range stmt.setters {
+		methods = append(methods, a.resolveFunction(setter, SETTER))
+	}
+
+	for _, abstract := range stmt.abstracts {
+		methods = append(methods, a.resolveFunction(abstract, ABSTRACT))
+	}
+
+	var interfaces []interface{}
+
+	for _, iface := range stmt.interfaces {
+		interfaces = append(interfaces, a.resolveExpr(&iface))
+	}
+
+	var traits []interface{}
+
+	for _, trait := range stmt.traits {
+		traits = append(traits, a.resolveExpr(&trait))
+	}
+
+	var decorators []interface{}
+
+	for _, decorator := range stmt.decorators {
+		decorators = append(decorators, a.resolveExpr(decorator))
+	}
+
 	return Node{
 		"_type":      "ClassStatement",
 		"id":         stmt.name.lexeme,
+		"decorators": decorators,
 		"superclass": a.resolveExpr(&stmt.superclass),
+		"traits":     traits,
+		"interfaces": interfaces,
+		"fields":     fields,
 		"body":       methods,
 	}
 }
 
+func (a *AstPrinter) visitTraitStmt(stmt *Trait) interface{} {
+	var methods []interface{}
+
+	for _, method := range stmt.methods {
+		kind := METHOD
+		if method.name.lexeme == "init" {
+			kind = INITIALIZER
+		}
+		methods = append(methods, a.resolveFunction(method, kind))
+	}
+
+	return Node{
+		"_type": "TraitStatement",
+		"id":    stmt.name.lexeme,
+		"body":  methods,
+	}
+}
+
+func (a *AstPrinter) visitInterfaceStmt(stmt *Interface) interface{} {
+	var methods []interface{}
+
+	for _, method := range stmt.methods {
+		methods = append(methods, a.resolveFunction(method, ABSTRACT))
+	}
+
+	return Node{
+		"_type": "InterfaceStatement",
+		"id":    stmt.name.lexeme,
+		"body":  methods,
+	}
+}
+
+func (a *AstPrinter) visitEnumStmt(stmt *Enum) interface{} {
+	members := []Node{}
+
+	for _, member := range stmt.members {
+		members = append(members, Node{
+			"_type": "Identifier",
+			"name":  member.lexeme,
+		})
+	}
+
+	return Node{
+		"_type":   "EnumStatement",
+		"id":      stmt.name.lexeme,
+		"members": members,
+	}
+}
+
+func (a *AstPrinter) visitRecordStmt(stmt *Record) interface{} {
+	fields := []Node{}
+
+	for _, field := range stmt.fields {
+		fields = append(fields, Node{
+			"_type": "Identifier",
+			"name":  field.lexeme,
+		})
+	}
+
+	return Node{
+		"_type":  "RecordStatement",
+		"id":     stmt.name.lexeme,
+		"fields": fields,
+	}
+}
+
 func (a *AstPrinter) visitExpressionStmt(stmt *Expression) interface{} {
 	return Node{
 		"_type":      "ExpressionStatement",
@@ -215,17 +346,116 @@ func (a *AstPrinter) visitReturnStmt(stmt *Return) interface{} {
 	}
 }
 
-func (a *AstPrinter) visitBreakStmt(_ *Break) interface{} {
+func (a *AstPrinter) visitBreakStmt(stmt *Break) interface{} {
 	return Node{
 		"_type": "BreakStatement",
+		"label": labelName(stmt.label),
+	}
+}
+
+func (a *AstPrinter) visitContinueStmt(stmt *Continue) interface{} {
+	return Node{
+		"_type": "ContinueStatement",
+		"label": labelName(stmt.label),
+	}
+}
+
+func (a *AstPrinter) visitDeferStmt(stmt *Defer) interface{} {
+	return Node{
+		"_type":      "DeferStatement",
+		"expression": a.resolveExpr(stmt.call),
+	}
+}
+
+func (a *AstPrinter) visitExtensionStmt(stmt *Extension) interface{} {
+	var methods []interface{}
+	for _, method := range stmt.methods {
+		methods = append(methods, a.resolveFunction(method, METHOD))
+	}
+
+	return Node{
+		"_type":   "ExtensionStatement",
+		"id":      stmt.target.name.lexeme,
+		"methods": methods,
+	}
+}
+
+func (a *AstPrinter) visitSpawnStmt(stmt *Spawn) interface{} {
+	return Node{
+		"_type":      "SpawnStatement",
+		"expression": a.resolveExpr(stmt.call),
+	}
+}
+
+func (a *AstPrinter) visitSelectStmt(stmt *Select) interface{} {
+	cases := []Node{}
+	for _, c := range stmt.cases {
+		cases = append(cases, Node{
+			"_type":     "SelectCase",
+			"operation": c.operation.lexeme,
+			"id":        labelName(c.name),
+			"channel":   a.resolveExpr(c.channel),
+			"value":     a.resolveExpr(c.value),
+			"body":      a.resolve(c.body),
+		})
+	}
+
+	return Node{
+		"_type":     "SelectStatement",
+		"cases":     cases,
+		"alternate": a.resolveStmt(stmt.fallback),
+	}
+}
+
+func (a *AstPrinter) visitAssertStmt(stmt *Assert) interface{} {
+	return Node{
+		"_type":   "AssertStatement",
+		"test":    a.resolveExpr(stmt.condition),
+		"message": a.resolveExpr(stmt.message),
+	}
+}
+
+func (a *AstPrinter) visitTestStmt(stmt *Test) interface{} {
+	return Node{
+		"_type": "TestDeclaration",
+		"name":  stmt.name.literal,
+		"body":  a.resolve(stmt.body),
+	}
+}
+
+func (a *AstPrinter) visitMacroStmt(stmt *Macro) interface{} {
+	var params []string
+	for _, param := range stmt.params {
+		params = append(params, param.lexeme)
+	}
+
+	return Node{
+		"_type":  "MacroDeclaration",
+		"id":     stmt.name.lexeme,
+		"params": params,
+		"body":   a.resolve(stmt.body),
 	}
 }
 
 func (a *AstPrinter) visitVarStmt(stmt *Var) interface{} {
 	return Node{
-		"_type": "VariableDeclaration",
-		"id":    stmt.name.lexeme,
-		"init":  a.resolveExpr(stmt.initializer),
+		"_type":          "VariableDeclaration",
+		"id":             stmt.name.lexeme,
+		"typeAnnotation": typeName(stmt.annotation),
+		"init":           a.resolveExpr(stmt.initializer),
+	}
+}
+
+func (a *AstPrinter) visitForInStmt(stmt *ForIn) interface{} {
+	return Node{
+		"_type": "ForInStatement",
+		"left": Node{
+			"_type": "Identifier",
+			"name":  stmt.name.lexeme,
+		},
+		"right": a.resolveExpr(stmt.iterable),
+		"body":  a.resolveStmt(stmt.body),
+		"label": labelName(stmt.label),
 	}
 }
 
@@ -233,7 +463,9 @@ func (a *AstPrinter) visitWhileStmt(stmt *While) interface{} {
 	return Node{
 		"_type":     "WhileStatement",
 		"condition": a.resolveExpr(stmt.condition),
+		"update":    a.resolveExpr(stmt.increment),
 		"body":      a.resolveStmt(stmt.body),
+		"label":     labelName(stmt.label),
 	}
 }
 
@@ -259,27 +491,36 @@ func (a *AstPrinter) resolveStmt(stmt Stmt) interface{} {
 
 func (a *AstPrinter) resolveExpr(expr Expr) interface{} {
 	if expr != nil {
-		expr.accept(a)
+		return expr.accept(a)
 	}
 	return nil
 }
 
 func (a *AstPrinter) resolveFunction(f Function, kind FunctionType) interface{} {
 	params := []Node{}
-	for _, param := range f.params {
+	for i, param := range f.params {
 		node := Node{
-			"_type": "Identifier",
-			"name":  param.lexeme,
+			"_type":          "Identifier",
+			"name":           param.lexeme,
+			"typeAnnotation": typeName(f.paramTypes[i]),
 		}
 		params = append(params, node)
 	}
 
+	var decorators []interface{}
+	for _, decorator := range f.decorators {
+		decorators = append(decorators, a.resolveExpr(decorator))
+	}
+
 	return Node{
-		"_type":  "FunctionStatement",
-		"id":     f.name.lexeme,
-		"kind":   kind,
-		"params": params,
-		"body":   a.resolve(f.body),
+		"_type":      "FunctionStatement",
+		"id":         f.name.lexeme,
+		"kind":       kind,
+		"async":      f.async,
+		"decorators": decorators,
+		"params":     params,
+		"returnType": typeName(f.returnType),
+		"body":       a.resolve(f.body),
 	}
 }
 
@@ -293,6 +534,22 @@ func unescapeUnicodeCharacters(raw json.RawMessage) (json.RawMessage, error) {
 	return []byte(str), nil
 }
 
+// labelName returns nil for loops and jumps without a label
+func labelName(label Token) interface{} {
+	if label == (Token{}) {
+		return nil
+	}
+	return label.lexeme
+}
+
+// typeName returns nil for declarations without a type annotation
+func typeName(annotation Token) interface{} {
+	if annotation == (Token{}) {
+		return nil
+	}
+	return annotation.lexeme
+}
+
 // see Parser.primary for possible values
 func getLiteralType(value interface{}) string {
 	switch value.(type) {
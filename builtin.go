@@ -0,0 +1,188 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// builtinTypeNames are the primitive types which can have methods,
+// the names are the same as in type annotations
+var builtinTypeNames = []string{"String", "Number", "Bool"}
+
+func isBuiltinType(name string) bool {
+	for _, n := range builtinTypeNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinTypeName returns the name of the builtin type of a value,
+// or an empty string for values which can't have methods
+func builtinTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "String"
+	case float64:
+		return "Number"
+	case bool:
+		return "Bool"
+	}
+	return ""
+}
+
+// BuiltinType is the method table of a primitive type, it holds
+// methods written in Go and the ones added by extend statements
+type BuiltinType struct {
+	name    string
+	natives map[string]NativeMethod
+	methods map[string]LoxFunction
+	lock    sync.RWMutex // guards methods, extend statements can add to them while tasks call them
+}
+
+// NativeMethod is a method of a builtin type written in Go
+type NativeMethod struct {
+	arity    int
+	function func(this interface{}, args []interface{}) (interface{}, error)
+}
+
+func NewBuiltinTypes() map[string]*BuiltinType {
+	natives := map[string]map[string]NativeMethod{
+		"String": stringMethods,
+		"Number": numberMethods,
+		"Bool":   {},
+	}
+
+	types := map[string]*BuiltinType{}
+	for _, name := range builtinTypeNames {
+		types[name] = &BuiltinType{name: name, natives: natives[name], methods: map[string]LoxFunction{}}
+	}
+	return types
+}
+
+// extend adds a method unless the type already has one with its name
+func (b *BuiltinType) extend(name string, method LoxFunction) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	_, isNative := b.natives[name]
+	_, isMethod := b.methods[name]
+	if isNative || isMethod {
+		return false
+	}
+	b.methods[name] = method
+	return true
+}
+
+// get returns the method bound to a value of this type
+func (b *BuiltinType) get(value interface{}, name Token) (interface{}, error) {
+	b.lock.RLock()
+	method, ok := b.methods[name.lexeme]
+	b.lock.RUnlock()
+	if ok {
+		return method.bindValue(value), nil
+	}
+
+	if native, ok := b.natives[name.lexeme]; ok {
+		return NewNativeFunction(name.lexeme, native.arity, func(_ *Interpreter, args []interface{}) (interface{}, error) {
+			return native.function(value, args)
+		}), nil
+	}
+
+	return nil, NewRuntimeError(name, "undefined property '"+name.lexeme+"'.")
+}
+
+var stringMethods = map[string]NativeMethod{
+	"length": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return float64(utf8.RuneCountInString(this.(string))), nil
+	}},
+	"upper": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return strings.ToUpper(this.(string)), nil
+	}},
+	"lower": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return strings.ToLower(this.(string)), nil
+	}},
+	"trim": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return strings.TrimSpace(this.(string)), nil
+	}},
+	"contains": {1, func(this interface{}, args []interface{}) (interface{}, error) {
+		substr, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(this.(string), substr), nil
+	}},
+	"startsWith": {1, func(this interface{}, args []interface{}) (interface{}, error) {
+		prefix, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(this.(string), prefix), nil
+	}},
+	"endsWith": {1, func(this interface{}, args []interface{}) (interface{}, error) {
+		suffix, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(this.(string), suffix), nil
+	}},
+	// indexOf counts characters rather than bytes, -1 if not found
+	"indexOf": {1, func(this interface{}, args []interface{}) (interface{}, error) {
+		substr, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		s := this.(string)
+		i := strings.Index(s, substr)
+		if i < 0 {
+			return float64(-1), nil
+		}
+		return float64(utf8.RuneCountInString(s[:i])), nil
+	}},
+	"repeat": {1, func(this interface{}, args []interface{}) (interface{}, error) {
+		count, err := toNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 || count != math.Trunc(count) {
+			return nil, NewCallError("argument must be a non-negative integer")
+		}
+		return strings.Repeat(this.(string), int(count)), nil
+	}},
+}
+
+var numberMethods = map[string]NativeMethod{
+	"floor": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return math.Floor(this.(float64)), nil
+	}},
+	"ceil": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return math.Ceil(this.(float64)), nil
+	}},
+	"round": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return math.Round(this.(float64)), nil
+	}},
+	"abs": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return math.Abs(this.(float64)), nil
+	}},
+	"sqrt": {0, func(this interface{}, _ []interface{}) (interface{}, error) {
+		return math.Sqrt(this.(float64)), nil
+	}},
+}
+
+func toString(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", NewCallError("argument must be a string")
+	}
+	return s, nil
+}
+
+func toNumber(value interface{}) (float64, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return 0, NewCallError("argument must be a number")
+	}
+	return n, nil
+}
@@ -1,6 +1,28 @@
 package main
 
+import "fmt"
+
+// VARIADIC is the arity of natives taking any number of arguments
+const VARIADIC = -1
+
 type LoxCallable interface {
 	arity() int
-	call(interpreter *Interpreter, args []interface{}) interface{}
+	// call returns a RuntimeError raised by the callee, or a CallError
+	// which the interpreter reports at the call site
+	call(interpreter *Interpreter, args []interface{}) (interface{}, error)
+}
+
+// LoxIterable is implemented by values that can be looped over with for-in
+type LoxIterable interface {
+	// iterator returns a function yielding the next value until ok is false
+	iterator() func() (value interface{}, ok bool)
+}
+
+// checkArity raises an error at the call site when a call has the wrong number of arguments
+func checkArity(callee LoxCallable, argc int, token Token) error {
+	if arity := callee.arity(); arity != VARIADIC && argc != arity {
+		msg := fmt.Sprintf("expected %d arguments but got %d", arity, argc)
+		return NewRuntimeError(token, msg)
+	}
+	return nil
 }
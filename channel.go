@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+)
+
+// LoxChannel passes values between tasks, sends block until the value is received
+type LoxChannel struct {
+	values chan interface{}
+}
+
+func NewLoxChannel() *LoxChannel {
+	return &LoxChannel{make(chan interface{})}
+}
+
+// deadlockMessage is raised by channel operations which would block forever
+const deadlockMessage = "deadlock, all tasks are blocked on channels"
+
+// send and close recover from Go's panic on a closed channel
+func (c *LoxChannel) send(tasks *TaskGroup, value interface{}) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = NewCallError("send on closed channel")
+		}
+	}()
+	cases := []reflect.SelectCase{{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.values), Send: reflect.ValueOf(&value).Elem()}}
+	if _, _, _, deadlocked := tasks.choose(cases); deadlocked {
+		return NewCallError(deadlockMessage)
+	}
+	return nil
+}
+
+// recv returns nil once the channel is closed and empty
+func (c *LoxChannel) recv(tasks *TaskGroup) (interface{}, error) {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.values)}}
+	_, value, ok, deadlocked := tasks.choose(cases)
+	if deadlocked {
+		return nil, NewCallError(deadlockMessage)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return value.Interface(), nil
+}
+
+func (c *LoxChannel) close() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = NewCallError("close of closed channel")
+		}
+	}()
+	close(c.values)
+	return nil
+}
+
+func (c *LoxChannel) String() string {
+	return "<channel>"
+}
+
+// defineChannelNatives adds the functions for creating and using channels
+func defineChannelNatives(globals *Globals) {
+	globals.define("chan", NewNativeFunction("chan", 0, func(_ *Interpreter, _ []interface{}) (interface{}, error) {
+		return NewLoxChannel(), nil
+	}))
+	globals.define("send", NewNativeFunction("send", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		channel, err := toChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return nil, channel.send(interpreter.tasks, args[1])
+	}))
+	globals.define("recv", NewNativeFunction("recv", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		channel, err := toChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return channel.recv(interpreter.tasks)
+	}))
+	globals.define("close", NewNativeFunction("close", 1, func(_ *Interpreter, args []interface{}) (interface{}, error) {
+		channel, err := toChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return nil, channel.close()
+	}))
+}
+
+func toChannel(value interface{}) (*LoxChannel, error) {
+	channel, ok := value.(*LoxChannel)
+	if !ok {
+		return nil, NewCallError("argument must be a channel")
+	}
+	return channel, nil
+}
+
+// SelectCase is a case of a select statement, operation is the "recv" or "send"
+// token and name is the variable receiving the value, if any
+type SelectCase struct {
+	operation Token
+	name      Token
+	channel   Expr
+	value     Expr
+	body      []Stmt
+}
+
+// chooseCase blocks until one of the cases can proceed and returns its index,
+// a random one is picked if several are ready like Go's select
+func chooseCase(keyword Token, tasks *TaskGroup, cases []reflect.SelectCase) (chosen int, value interface{}, err error) {
+	defer func() {
+		if recover() != nil {
+			err = NewRuntimeError(keyword, "send on closed channel")
+		}
+	}()
+
+	chosen, received, ok, deadlocked := tasks.choose(cases)
+	if deadlocked {
+		return 0, nil, NewRuntimeError(keyword, deadlockMessage)
+	}
+	if ok {
+		value = received.Interface()
+	}
+	return chosen, value, nil
+}
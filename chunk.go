@@ -0,0 +1,76 @@
+package main
+
+// OpCode is a bytecode instruction of the VM, operands follow the opcode
+// in the code of a chunk and are two bytes long unless noted otherwise
+type OpCode byte
+
+const (
+	OP_CONSTANT       OpCode = iota // constant index
+	OP_NIL                          //
+	OP_TRUE                         //
+	OP_FALSE                        //
+	OP_POP                          //
+	OP_UNWIND                       // count, pops locals closing the upvalues capturing them
+	OP_GET_LOCAL                    // slot
+	OP_SET_LOCAL                    // slot
+	OP_GET_GLOBAL                   // index in Globals
+	OP_DEFINE_GLOBAL                // index in Globals
+	OP_SET_GLOBAL                   // index in Globals
+	OP_GET_UPVALUE                  // upvalue index
+	OP_SET_UPVALUE                  // upvalue index
+	OP_GET_PROPERTY                 // constant index of the name
+	OP_SET_PROPERTY                 // constant index of the name
+	OP_GET_SUPER                    // constant index of the name
+	OP_CHECK_INSTANCE               // raises an error unless the object of a set expression is an instance
+	OP_BINARY                       // one byte TokenType of the operator
+	OP_NOT                          //
+	OP_NEGATE                       //
+	OP_SLICE_BOUND                  // raises an error unless a slice bound is an integer or nil
+	OP_SLICE                        //
+	OP_PRINT                        //
+	OP_JUMP                         // forward offset
+	OP_JUMP_IF_FALSE                // forward offset, leaves the condition on the stack
+	OP_LOOP                         // backward offset
+	OP_CALL                         // one byte argument count
+	OP_CLOSURE                      // constant index of the function
+	OP_RETURN                       //
+	OP_CLASS                        // constant index of the name, one byte set if the superclass is on the stack
+	OP_METHOD                       // constant index of the name
+	OP_GETTER                       // constant index of the name
+	OP_SETTER                       // constant index of the name
+	OP_FIELD                        // constant index of the name, one byte set if an initializer is on the stack
+	OP_RECORD                       // constant index of the declaration
+	OP_ENUM                         // constant index of the declaration
+	OP_ITERATOR                     //
+	OP_FOR_NEXT                     // forward offset taken once the iterator is done
+	OP_ASSERT                       // constant index of the statement, forward offset taken if the assertion holds
+	OP_ASSERT_FAIL                  // constant index of the statement
+)
+
+// Chunk is the compiled code of a function, tokens holds the token each
+// byte of code was compiled from so that errors are reported like the Interpreter does
+type Chunk struct {
+	code      []byte
+	tokens    []Token
+	constants []interface{}
+}
+
+func (c *Chunk) write(b byte, token Token) {
+	c.code = append(c.code, b)
+	c.tokens = append(c.tokens, token)
+}
+
+func (c *Chunk) writeShort(value int, token Token) {
+	c.write(byte(value>>8), token)
+	c.write(byte(value), token)
+}
+
+func (c *Chunk) readShort(offset int) int {
+	return int(c.code[offset])<<8 | int(c.code[offset+1])
+}
+
+// addConstant returns the index of the constant
+func (c *Chunk) addConstant(value interface{}) int {
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
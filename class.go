@@ -1,17 +1,38 @@
 package main
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// thisClass is bound in the slot after "this" and holds the class declaring
+// the method so that private members can be checked against it
+const thisClass = "this class"
+
 // LoxClass implements LoxCallable
 type LoxClass struct {
 	name       string
 	superclass *LoxClass
 	methods    map[string]LoxFunction
+	getters    map[string]LoxFunction
+	setters    map[string]LoxFunction
+	abstract   map[string]int // arity of methods that subclasses must implement
+	fields     []Var
+	closure    *Environment  // for evaluating field initializers
+	record     *Record       // declaration of a record, nil for other classes
+	lock       *sync.RWMutex // guards methods, extend statements can add to them while tasks call them
 }
 
-func NewLoxClass(name string, superclass *LoxClass, methods map[string]LoxFunction) *LoxClass {
-	return &LoxClass{name, superclass, methods}
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]LoxFunction, getters map[string]LoxFunction, setters map[string]LoxFunction, abstract map[string]int, fields []Var, closure *Environment) *LoxClass {
+	return &LoxClass{name, superclass, methods, getters, setters, abstract, fields, closure, nil, &sync.RWMutex{}}
 }
 
 func (l *LoxClass) arity() int {
+	if l.record != nil {
+		return len(l.record.fields)
+	}
 	initializer := l.findMethod("init")
 	if initializer == nil {
 		return 0
@@ -19,17 +40,86 @@ func (l *LoxClass) arity() int {
 	return initializer.arity()
 }
 
-func (l *LoxClass) call(interpreter *Interpreter, args []interface{}) interface{} {
-	instance := LoxInstance{*l, map[string]interface{}{}}
+func (l *LoxClass) call(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	if err := l.checkAbstract(); err != nil {
+		return nil, err
+	}
+	instance := NewLoxInstance(l)
+	if l.record != nil {
+		instance.initRecord(args)
+		return instance, nil
+	}
+	if err := l.initFields(interpreter, instance); err != nil {
+		return nil, err
+	}
 	initializer := l.findMethod("init")
 	if initializer != nil {
-		initializer.bind(&instance).call(interpreter, args)
+		if _, err := initializer.bind(instance).call(interpreter, args); err != nil {
+			return nil, err
+		}
 	}
-	return instance
+	return instance, nil
+}
+
+// checkAbstract prevents instantiating a class with unimplemented abstract methods
+func (l *LoxClass) checkAbstract() error {
+	for class := l; class != nil; class = class.superclass {
+		names := make([]string, 0, len(class.abstract))
+		for name := range class.abstract {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			method := l.findMethod(name)
+			if method == nil {
+				msg := fmt.Sprintf("can't instantiate abstract class '%s', '%s' is not implemented", l.name, name)
+				return NewCallError(msg)
+			}
+			if arity := class.abstract[name]; method.arity() != arity {
+				msg := fmt.Sprintf("'%s' must take %d parameters but takes %d", name, arity, method.arity())
+				return NewCallError(msg)
+			}
+		}
+	}
+	return nil
+}
+
+// initFields sets declared fields to their default values, starting with
+// the ones inherited from the superclass
+func (l *LoxClass) initFields(interpreter *Interpreter, instance *LoxInstance) error {
+	if l.superclass != nil {
+		if err := l.superclass.initFields(interpreter, instance); err != nil {
+			return err
+		}
+	}
+
+	environment := NewEnvironment(l.closure)
+	environment.define(instance)
+	environment.define(l)
+
+	for _, field := range l.fields {
+		var value interface{}
+		if field.initializer != nil {
+			v, err := interpreter.evaluateIn(field.initializer, environment)
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+		instance.lock.Lock()
+		if isPrivate(field.name.lexeme) {
+			instance.private[memberKey{l, field.name.lexeme}] = value
+		} else {
+			instance.fields[field.name.lexeme] = value
+		}
+		instance.lock.Unlock()
+	}
+	return nil
 }
 
 func (l *LoxClass) findMethod(name string) *LoxFunction {
-	if v, ok := l.methods[name]; ok {
+	if v, ok := l.ownMethod(name); ok {
 		return &v
 	}
 	if l.superclass != nil {
@@ -38,32 +128,244 @@ func (l *LoxClass) findMethod(name string) *LoxFunction {
 	return nil
 }
 
+func (l *LoxClass) findGetter(name string) *LoxFunction {
+	if v, ok := l.getters[name]; ok {
+		return &v
+	}
+	if l.superclass != nil {
+		return l.superclass.findGetter(name)
+	}
+	return nil
+}
+
+func (l *LoxClass) findSetter(name string) *LoxFunction {
+	if v, ok := l.setters[name]; ok {
+		return &v
+	}
+	if l.superclass != nil {
+		return l.superclass.findSetter(name)
+	}
+	return nil
+}
+
 func (l LoxClass) String() string {
 	return l.name
 }
 
+// isSubclassOf returns true if the class is other or inherits from it
+func (l *LoxClass) isSubclassOf(other *LoxClass) bool {
+	for class := l; class != nil; class = class.superclass {
+		if class == other {
+			return true
+		}
+	}
+	return false
+}
+
+// ownMethod returns a method declared by the class itself or added by an extension
+func (l *LoxClass) ownMethod(name string) (LoxFunction, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	v, ok := l.methods[name]
+	return v, ok
+}
+
+// extend adds a method unless the class already has a member or field with its name
+func (l *LoxClass) extend(name string, method LoxFunction) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.methods[name]; ok || l.hasField(name) {
+		return false
+	}
+	if _, ok := l.getters[name]; ok {
+		return false
+	}
+	if _, ok := l.setters[name]; ok {
+		return false
+	}
+	l.methods[name] = method
+	return true
+}
+
+// hasMember returns true if the class itself declares a method, getter or setter
+func (l *LoxClass) hasMember(name string) bool {
+	_, isMethod := l.ownMethod(name)
+	_, isGetter := l.getters[name]
+	_, isSetter := l.setters[name]
+	return isMethod || isGetter || isSetter
+}
+
+// hasField returns true if the class itself declares a field
+func (l *LoxClass) hasField(name string) bool {
+	for _, field := range l.fields {
+		if field.name.lexeme == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoxInstance is always used through a pointer so that an instance
+// has a single identity however many variables refer to it
 type LoxInstance struct {
-	class  LoxClass
-	fields map[string]interface{}
+	class   *LoxClass
+	fields  map[string]interface{}
+	private map[memberKey]interface{}
+	lock    *sync.RWMutex // guards the maps, instances can be shared by spawned tasks
+}
+
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{class, map[string]interface{}{}, map[memberKey]interface{}{}, &sync.RWMutex{}}
+}
+
+// memberKey identifies a member by its declaring class
+// private members are stored this way so that subclasses can't see them
+type memberKey struct {
+	class *LoxClass
+	name  string
 }
 
-func (l *LoxInstance) get(name Token) interface{} {
-	if v, ok := l.fields[name.lexeme]; ok {
-		return v
+func isPrivate(name string) bool {
+	return strings.HasPrefix(name, "#")
+}
+
+func (l *LoxInstance) get(interpreter *Interpreter, name Token) (interface{}, error) {
+	if isPrivate(name.lexeme) {
+		return nil, NewRuntimeError(name, "private members can only be accessed through 'this'.")
+	}
+
+	l.lock.RLock()
+	v, ok := l.fields[name.lexeme]
+	l.lock.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	if l.class.record != nil {
+		if method := l.recordMethod(name.lexeme); method != nil {
+			return method, nil
+		}
+	}
+
+	// getters run on property access
+	getter := l.class.findGetter(name.lexeme)
+	if getter != nil {
+		return getter.bind(l).call(interpreter, nil)
 	}
 
 	method := l.class.findMethod(name.lexeme)
 	if method != nil {
-		return method.bind(l)
+		return l.bindMethod(method), nil
 	}
 
-	panic(NewRuntimeError(name, "undefined property '"+name.lexeme+"'."))
+	return nil, NewRuntimeError(name, "undefined property '"+name.lexeme+"'.")
 }
 
-func (l *LoxInstance) set(name Token, value interface{}) {
+func (l *LoxInstance) set(interpreter *Interpreter, name Token, value interface{}) error {
+	if isPrivate(name.lexeme) {
+		return NewRuntimeError(name, "private members can only be accessed through 'this'.")
+	}
+
+	if l.class.record != nil {
+		return NewRuntimeError(name, "can't assign to a field of record '"+l.class.name+"'.")
+	}
+
+	setter := l.class.findSetter(name.lexeme)
+	if setter != nil {
+		_, err := setter.bind(l).call(interpreter, []interface{}{value})
+		return err
+	}
+
+	// a getter without a matching setter makes the property read-only
+	if l.class.findGetter(name.lexeme) != nil {
+		return NewRuntimeError(name, "can't set read-only property '"+name.lexeme+"'.")
+	}
+
+	l.lock.Lock()
 	l.fields[name.lexeme] = value
+	l.lock.Unlock()
+	return nil
+}
+
+// bindMethod binds a method to the instance, decorated methods were
+// decorated when the class was declared and take the instance as argument
+func (l *LoxInstance) bindMethod(method *LoxFunction) interface{} {
+	if method.decorated != nil {
+		return &boundDecorated{l, method.decorated}
+	}
+	return method.bind(l)
 }
 
-func (l LoxInstance) String() string {
+// getPrivate looks up a private member declared by the owner class
+func (l *LoxInstance) getPrivate(interpreter *Interpreter, owner *LoxClass, name Token) (interface{}, error) {
+	if owner == nil {
+		return nil, NewRuntimeError(name, "private members can only be accessed through 'this'.")
+	}
+
+	l.lock.RLock()
+	v, ok := l.private[memberKey{owner, name.lexeme}]
+	l.lock.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	if getter, ok := owner.getters[name.lexeme]; ok {
+		return getter.bind(l).call(interpreter, nil)
+	}
+
+	if method, ok := owner.ownMethod(name.lexeme); ok {
+		return l.bindMethod(&method), nil
+	}
+
+	if class := l.privateOwner(name.lexeme); class != "" {
+		return nil, NewRuntimeError(name, "can't access private member '"+name.lexeme+"' of class '"+class+"'.")
+	}
+
+	return nil, NewRuntimeError(name, "undefined property '"+name.lexeme+"'.")
+}
+
+// setPrivate assigns a private member declared by the owner class
+func (l *LoxInstance) setPrivate(interpreter *Interpreter, owner *LoxClass, name Token, value interface{}) error {
+	if owner == nil {
+		return NewRuntimeError(name, "private members can only be accessed through 'this'.")
+	}
+
+	if setter, ok := owner.setters[name.lexeme]; ok {
+		_, err := setter.bind(l).call(interpreter, []interface{}{value})
+		return err
+	}
+
+	if _, ok := owner.getters[name.lexeme]; ok {
+		return NewRuntimeError(name, "can't set read-only property '"+name.lexeme+"'.")
+	}
+
+	l.lock.Lock()
+	l.private[memberKey{owner, name.lexeme}] = value
+	l.lock.Unlock()
+	return nil
+}
+
+// privateOwner returns the name of a class holding the given private member
+func (l *LoxInstance) privateOwner(name string) string {
+	l.lock.RLock()
+	for key := range l.private {
+		if key.name == name {
+			l.lock.RUnlock()
+			return key.class.name
+		}
+	}
+	l.lock.RUnlock()
+	for class := l.class; class != nil; class = class.superclass {
+		if class.hasMember(name) {
+			return class.name
+		}
+	}
+	return ""
+}
+
+func (l *LoxInstance) String() string {
+	if l.class.record != nil {
+		return l.recordString()
+	}
 	return l.class.name + " instance"
 }
@@ -0,0 +1,776 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Compiler implements ExprVisitor, StmtVisitor
+// it compiles resolved statements to the bytecode run by the VM, a
+// Compiler is created for each function with the enclosing one's as parent
+type Compiler struct {
+	enclosing  *Compiler
+	function   *vmFunction
+	typ        FunctionType
+	locals     []compilerLocal
+	scopeDepth int
+	loops      []compilerLoop
+	hoisted    map[*Function]*vmFunction
+	globals    *Globals
+	replMode   bool
+	tests      map[*Test]*vmFunction
+}
+
+// compilerLocal is a variable on the stack, slots follow the order of declaration
+// except in blocks with hoisted functions, see Compiler.hoist
+type compilerLocal struct {
+	name     string
+	depth    int
+	reserved bool // the slot is taken but the variable isn't declared yet
+}
+
+// compilerLoop holds the jumps out of a loop body which are patched once
+// the loop is compiled, locals above localCount are popped when jumping
+type compilerLoop struct {
+	label      string
+	localCount int
+	breaks     []int
+	continues  []int
+}
+
+func NewCompiler(globals *Globals, replMode bool) *Compiler {
+	return &Compiler{
+		function: &vmFunction{name: "script"},
+		typ:      NONE,
+		locals:   []compilerLocal{{"", 0, false}},
+		hoisted:  map[*Function]*vmFunction{},
+		globals:  globals,
+		replMode: replMode,
+		tests:    map[*Test]*vmFunction{},
+	}
+}
+
+// compile returns the function running the top-level statements,
+// errors are reported like the Resolver does
+func (c *Compiler) compile(statements []Stmt) *vmFunction {
+	for _, stmt := range statements {
+		c.compileStmt(stmt)
+	}
+	c.emitReturn(Token{})
+	return c.function
+}
+
+// child creates the compiler of a function declared in the current one,
+// slot 0 holds the callee or "this" in methods
+func (c *Compiler) child(function *vmFunction, typ FunctionType) *Compiler {
+	compiler := &Compiler{
+		enclosing: c,
+		function:  function,
+		typ:       typ,
+		hoisted:   map[*Function]*vmFunction{},
+		globals:   c.globals,
+		tests:     c.tests,
+	}
+	slot := ""
+	if typ != FUNCTION {
+		slot = "this"
+	}
+	compiler.locals = append(compiler.locals, compilerLocal{slot, 0, false})
+	return compiler
+}
+
+func (c *Compiler) compileStmt(stmt Stmt) {
+	stmt.accept(c)
+}
+
+func (c *Compiler) compileExpr(expr Expr) {
+	expr.accept(c)
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return &c.function.chunk
+}
+
+func (c *Compiler) emit(op OpCode, token Token) {
+	c.chunk().write(byte(op), token)
+}
+
+func (c *Compiler) emitShort(op OpCode, operand int, token Token) {
+	c.emit(op, token)
+	c.chunk().writeShort(operand, token)
+}
+
+// emitJump returns the offset of the operand to patch
+func (c *Compiler) emitJump(op OpCode, token Token) int {
+	c.emitShort(op, 0xffff, token)
+	return len(c.chunk().code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	jump := len(c.chunk().code) - offset - 2
+	if jump > 0xffff {
+		fmt.Println(NewParseError(c.chunk().tokens[offset], "too much code to jump over"))
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(start int, token Token) {
+	offset := len(c.chunk().code) - start + 3
+	if offset > 0xffff {
+		fmt.Println(NewParseError(token, "loop body too large"))
+	}
+	c.emitShort(OP_LOOP, offset, token)
+}
+
+func (c *Compiler) emitConstant(value interface{}, token Token) {
+	c.emitShort(OP_CONSTANT, c.makeConstant(value, token), token)
+}
+
+func (c *Compiler) makeConstant(value interface{}, token Token) int {
+	index := c.chunk().addConstant(value)
+	if index > 0xffff {
+		fmt.Println(NewParseError(token, "too many constants in one function"))
+	}
+	return index
+}
+
+// emitReturn returns nil, or "this" from an initializer
+func (c *Compiler) emitReturn(token Token) {
+	if c.typ == INITIALIZER {
+		c.emitShort(OP_GET_LOCAL, 0, token)
+	} else {
+		c.emit(OP_NIL, token)
+	}
+	c.emit(OP_RETURN, token)
+}
+
+// unsupported reports constructs which only the Interpreter runs
+func (c *Compiler) unsupported(token Token, what string) {
+	fmt.Println(NewParseError(token, what+" are not supported by the bytecode VM"))
+}
+
+func (c *Compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *Compiler) endScope(token Token) {
+	c.scopeDepth--
+	count := 0
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		c.locals = c.locals[:len(c.locals)-1]
+		count++
+	}
+	c.emitUnwind(count, token)
+}
+
+func (c *Compiler) emitUnwind(count int, token Token) {
+	if count > 0 {
+		c.emitShort(OP_UNWIND, count, token)
+	}
+}
+
+func (c *Compiler) addLocal(name string) {
+	c.locals = append(c.locals, compilerLocal{name, c.scopeDepth, false})
+}
+
+// defineVariable defines the value on top of the stack, top-level
+// declarations of the script are globals like in the Resolver
+func (c *Compiler) defineVariable(name Token) {
+	if c.enclosing == nil && c.scopeDepth == 0 {
+		c.emitShort(OP_DEFINE_GLOBAL, c.globals.index(name.lexeme), name)
+		return
+	}
+	for slot := len(c.locals) - 1; slot >= 0 && c.locals[slot].depth == c.scopeDepth; slot-- {
+		if local := &c.locals[slot]; local.reserved && local.name == name.lexeme {
+			c.emitShort(OP_SET_LOCAL, slot, name)
+			c.emit(OP_POP, name)
+			local.reserved = false
+			return
+		}
+	}
+	c.addLocal(name.lexeme)
+}
+
+func (c *Compiler) resolveLocal(name string) int {
+	for slot := len(c.locals) - 1; slot >= 0; slot-- {
+		if c.locals[slot].name == name && !c.locals[slot].reserved {
+			return slot
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue returns the index of a variable captured from an enclosing function
+func (c *Compiler) resolveUpvalue(name string) int {
+	if c.enclosing == nil {
+		return -1
+	}
+	if slot := c.enclosing.resolveLocal(name); slot >= 0 {
+		return c.addUpvalue(upvalueRef{true, slot})
+	}
+	if index := c.enclosing.resolveUpvalue(name); index >= 0 {
+		return c.addUpvalue(upvalueRef{false, index})
+	}
+	return -1
+}
+
+func (c *Compiler) addUpvalue(upvalue upvalueRef) int {
+	for i, u := range c.function.upvalues {
+		if u == upvalue {
+			return i
+		}
+	}
+	c.function.upvalues = append(c.function.upvalues, upvalue)
+	return len(c.function.upvalues) - 1
+}
+
+func (c *Compiler) getVariable(name Token) {
+	if slot := c.resolveLocal(name.lexeme); slot >= 0 {
+		c.emitShort(OP_GET_LOCAL, slot, name)
+	} else if index := c.resolveUpvalue(name.lexeme); index >= 0 {
+		c.emitShort(OP_GET_UPVALUE, index, name)
+	} else {
+		c.emitShort(OP_GET_GLOBAL, c.globals.index(name.lexeme), name)
+	}
+}
+
+func (c *Compiler) setVariable(name Token) {
+	if slot := c.resolveLocal(name.lexeme); slot >= 0 {
+		c.emitShort(OP_SET_LOCAL, slot, name)
+	} else if index := c.resolveUpvalue(name.lexeme); index >= 0 {
+		c.emitShort(OP_SET_UPVALUE, index, name)
+	} else {
+		c.emitShort(OP_SET_GLOBAL, c.globals.index(name.lexeme), name)
+	}
+}
+
+// hoist creates the closures of the functions declared in a block when
+// entering it, their bodies are compiled where they're declared
+// the functions can be called before the other variables of the block are
+// declared so their slots are reserved too, holding nil until then
+func (c *Compiler) hoist(statements []Stmt) {
+	hoisted := false
+	for _, statement := range statements {
+		if f, ok := statement.(*Function); ok && isHoisted(f) {
+			function := &vmFunction{name: f.name.lexeme, arity: len(f.params)}
+			c.hoisted[f] = function
+			c.emitShort(OP_CLOSURE, c.makeConstant(function, f.name), f.name)
+			c.addLocal(f.name.lexeme)
+			hoisted = true
+		}
+	}
+	if !hoisted {
+		return
+	}
+	for _, statement := range statements {
+		if name, ok := declaredName(statement); ok {
+			c.emit(OP_NIL, name)
+			c.locals = append(c.locals, compilerLocal{name.lexeme, c.scopeDepth, true})
+		}
+	}
+}
+
+// declaredName returns the variable declared by a statement other than a hoisted function
+func declaredName(statement Stmt) (Token, bool) {
+	switch s := statement.(type) {
+	case *Var:
+		return s.name, true
+	case *Function:
+		return s.name, !isHoisted(s)
+	case *Class:
+		return s.name, true
+	case *Record:
+		return s.name, true
+	case *Enum:
+		return s.name, true
+	}
+	return Token{}, false
+}
+
+func (c *Compiler) compileBlock(statements []Stmt, token Token) {
+	c.beginScope()
+	c.hoist(statements)
+	for _, stmt := range statements {
+		c.compileStmt(stmt)
+	}
+	c.endScope(token)
+}
+
+// compileFunction compiles the body of a function into the given one,
+// the closure is created from it by OP_CLOSURE
+func (c *Compiler) compileFunction(declaration *Function, typ FunctionType, function *vmFunction) {
+	if len(declaration.decorators) > 0 {
+		c.unsupported(declaration.name, "decorators")
+	}
+	if declaration.async {
+		c.unsupported(declaration.name, "async functions")
+	}
+	function.isInit = typ == INITIALIZER
+	compiler := c.child(function, typ)
+	compiler.beginScope()
+	for _, param := range declaration.params {
+		compiler.addLocal(param.lexeme)
+	}
+	compiler.hoist(declaration.body)
+	for _, stmt := range declaration.body {
+		compiler.compileStmt(stmt)
+	}
+	compiler.emitReturn(declaration.name)
+}
+
+func (c *Compiler) emitClosure(declaration *Function, typ FunctionType) {
+	function := &vmFunction{name: declaration.name.lexeme, arity: len(declaration.params)}
+	c.compileFunction(declaration, typ, function)
+	c.emitShort(OP_CLOSURE, c.makeConstant(function, declaration.name), declaration.name)
+}
+
+// compileTest compiles the body of a test block, tests are run by the VM in test mode
+func (c *Compiler) compileTest(test *Test) {
+	function := &vmFunction{name: test.name.lexeme}
+	c.compileFunction(&Function{name: test.keyword, body: test.body}, FUNCTION, function)
+	c.tests[test] = function
+}
+
+func (c *Compiler) visitExpressionStmt(stmt *Expression) interface{} {
+	c.compileExpr(stmt.expression)
+	if c.replMode && c.enclosing == nil && c.scopeDepth == 0 {
+		c.emit(OP_PRINT, Token{})
+	} else {
+		c.emit(OP_POP, Token{})
+	}
+	return nil
+}
+
+func (c *Compiler) visitPrintStmt(stmt *Print) interface{} {
+	c.compileExpr(stmt.expression)
+	c.emit(OP_PRINT, Token{})
+	return nil
+}
+
+func (c *Compiler) visitVarStmt(stmt *Var) interface{} {
+	if isPrivate(stmt.name.lexeme) {
+		c.unsupported(stmt.name, "private members")
+	}
+	if stmt.initializer != nil {
+		c.compileExpr(stmt.initializer)
+	} else {
+		c.emit(OP_NIL, stmt.name)
+	}
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *Compiler) visitBlockStmt(stmt *Block) interface{} {
+	c.compileBlock(stmt.statements, Token{})
+	return nil
+}
+
+func (c *Compiler) visitFunctionStmt(stmt *Function) interface{} {
+	if function, ok := c.hoisted[stmt]; ok {
+		c.compileFunction(stmt, FUNCTION, function)
+		return nil
+	}
+	c.emitClosure(stmt, FUNCTION)
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *Compiler) visitIfStmt(stmt *If) interface{} {
+	c.compileExpr(stmt.condition)
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE, Token{})
+	c.emit(OP_POP, Token{})
+	c.compileStmt(stmt.thenBranch)
+	elseJump := c.emitJump(OP_JUMP, Token{})
+	c.patchJump(thenJump)
+	c.emit(OP_POP, Token{})
+	if stmt.elseBranch != nil {
+		c.compileStmt(stmt.elseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *Compiler) visitWhileStmt(stmt *While) interface{} {
+	loopStart := len(c.chunk().code)
+	c.compileExpr(stmt.condition)
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE, Token{})
+	c.emit(OP_POP, Token{})
+
+	loop := c.compileLoopBody(stmt.body, stmt.label, len(c.locals))
+	c.patchJumps(loop.continues)
+	if stmt.increment != nil {
+		c.compileExpr(stmt.increment)
+		c.emit(OP_POP, Token{})
+	}
+	c.emitLoop(loopStart, Token{})
+
+	c.patchJump(exitJump)
+	c.emit(OP_POP, Token{})
+	c.patchJumps(loop.breaks)
+	return nil
+}
+
+func (c *Compiler) visitForInStmt(stmt *ForIn) interface{} {
+	// the iterator is kept in a hidden local while looping
+	c.beginScope()
+	c.compileExpr(stmt.iterable)
+	c.emit(OP_ITERATOR, stmt.keyword)
+	c.addLocal("")
+
+	loopStart := len(c.chunk().code)
+	exitJump := c.emitJump(OP_FOR_NEXT, stmt.keyword)
+
+	// every iteration gets a fresh variable so closures capture its value,
+	// break and continue statements pop it like the locals of the body
+	c.beginScope()
+	localCount := len(c.locals)
+	c.addLocal(stmt.name.lexeme)
+	loop := c.compileLoopBody(stmt.body, stmt.label, localCount)
+	c.endScope(Token{})
+	c.patchJumps(loop.continues)
+	c.emitLoop(loopStart, Token{})
+
+	c.patchJump(exitJump)
+	c.patchJumps(loop.breaks)
+	c.endScope(Token{})
+	return nil
+}
+
+// compileLoopBody returns the jumps of break and continue statements targeting the loop,
+// they pop the locals declared after localCount
+func (c *Compiler) compileLoopBody(body Stmt, label Token, localCount int) compilerLoop {
+	c.loops = append(c.loops, compilerLoop{label: label.lexeme, localCount: localCount})
+	c.compileStmt(body)
+	loop := c.loops[len(c.loops)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+	return loop
+}
+
+func (c *Compiler) patchJumps(offsets []int) {
+	for _, offset := range offsets {
+		c.patchJump(offset)
+	}
+}
+
+// jump pops the locals of the loop body and jumps out of it,
+// the Resolver has checked that the targeted loop exists
+func (c *Compiler) jump(keyword Token, label Token, isBreak bool) {
+	for j := len(c.loops) - 1; j >= 0; j-- {
+		loop := &c.loops[j]
+		if !targets(label.lexeme, Token{lexeme: loop.label}) {
+			continue
+		}
+		c.emitUnwind(len(c.locals)-loop.localCount, keyword)
+		offset := c.emitJump(OP_JUMP, keyword)
+		if isBreak {
+			loop.breaks = append(loop.breaks, offset)
+		} else {
+			loop.continues = append(loop.continues, offset)
+		}
+		return
+	}
+}
+
+func (c *Compiler) visitBreakStmt(stmt *Break) interface{} {
+	c.jump(stmt.keyword, stmt.label, true)
+	return nil
+}
+
+func (c *Compiler) visitContinueStmt(stmt *Continue) interface{} {
+	c.jump(stmt.keyword, stmt.label, false)
+	return nil
+}
+
+func (c *Compiler) visitReturnStmt(stmt *Return) interface{} {
+	if stmt.value == nil {
+		c.emitReturn(stmt.keyword)
+		return nil
+	}
+	c.compileExpr(stmt.value)
+	c.emit(OP_RETURN, stmt.keyword)
+	return nil
+}
+
+func (c *Compiler) visitClassStmt(stmt *Class) interface{} {
+	if len(stmt.decorators) > 0 {
+		c.unsupported(stmt.name, "decorators")
+	}
+	if len(stmt.traits) > 0 {
+		c.unsupported(stmt.traits[0].name, "traits")
+	}
+	if len(stmt.interfaces) > 0 {
+		c.unsupported(stmt.interfaces[0].name, "interfaces")
+	}
+	if len(stmt.abstracts) > 0 {
+		c.unsupported(stmt.abstracts[0].name, "abstract methods")
+	}
+
+	hasSuperclass := stmt.superclass != (Variable{})
+	flag := byte(0)
+	token := stmt.name
+	if hasSuperclass {
+		c.getVariable(stmt.superclass.name)
+		flag = 1
+		token = stmt.superclass.name
+	}
+	c.emitShort(OP_CLASS, c.makeConstant(stmt.name.lexeme, stmt.name), token)
+	c.chunk().write(flag, token)
+	c.defineVariable(stmt.name)
+
+	if hasSuperclass {
+		c.beginScope()
+		c.getVariable(stmt.superclass.name)
+		c.addLocal("super")
+	}
+
+	c.getVariable(stmt.name)
+	for _, field := range stmt.fields {
+		if isPrivate(field.name.lexeme) {
+			c.unsupported(field.name, "private members")
+		}
+		hasInitializer := byte(0)
+		if field.initializer != nil {
+			// initializers run like methods so that they can use "this"
+			function := &vmFunction{name: field.name.lexeme}
+			compiler := c.child(function, METHOD)
+			compiler.compileExpr(field.initializer)
+			compiler.emit(OP_RETURN, field.name)
+			c.emitShort(OP_CLOSURE, c.makeConstant(function, field.name), field.name)
+			hasInitializer = 1
+		}
+		c.emitShort(OP_FIELD, c.makeConstant(field.name.lexeme, field.name), field.name)
+		c.chunk().write(hasInitializer, field.name)
+	}
+	c.compileMembers(stmt.methods, OP_METHOD)
+	c.compileMembers(stmt.getters, OP_GETTER)
+	c.compileMembers(stmt.setters, OP_SETTER)
+	c.emit(OP_POP, stmt.name)
+
+	if hasSuperclass {
+		c.endScope(stmt.name)
+	}
+	return nil
+}
+
+// compileMembers adds methods to the class on top of the stack
+func (c *Compiler) compileMembers(members []Function, op OpCode) {
+	for j := range members {
+		member := &members[j]
+		if isPrivate(member.name.lexeme) {
+			c.unsupported(member.name, "private members")
+		}
+		typ := METHOD
+		if op == OP_METHOD && member.name.lexeme == "init" {
+			typ = INITIALIZER
+		}
+		c.emitClosure(member, typ)
+		c.emitShort(op, c.makeConstant(member.name.lexeme, member.name), member.name)
+	}
+}
+
+func (c *Compiler) visitRecordStmt(stmt *Record) interface{} {
+	c.emitShort(OP_RECORD, c.makeConstant(stmt, stmt.name), stmt.name)
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *Compiler) visitEnumStmt(stmt *Enum) interface{} {
+	c.emitShort(OP_ENUM, c.makeConstant(stmt, stmt.name), stmt.name)
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *Compiler) visitTraitStmt(stmt *Trait) interface{} {
+	c.unsupported(stmt.name, "traits")
+	return nil
+}
+
+func (c *Compiler) visitInterfaceStmt(stmt *Interface) interface{} {
+	c.unsupported(stmt.name, "interfaces")
+	return nil
+}
+
+func (c *Compiler) visitExtensionStmt(stmt *Extension) interface{} {
+	c.unsupported(stmt.target.name, "extensions")
+	return nil
+}
+
+func (c *Compiler) visitDeferStmt(stmt *Defer) interface{} {
+	c.unsupported(stmt.keyword, "defer statements")
+	return nil
+}
+
+func (c *Compiler) visitSpawnStmt(stmt *Spawn) interface{} {
+	c.unsupported(stmt.keyword, "spawn statements")
+	return nil
+}
+
+func (c *Compiler) visitSelectStmt(stmt *Select) interface{} {
+	c.unsupported(stmt.keyword, "select statements")
+	return nil
+}
+
+// macros are expanded and removed before compiling
+func (c *Compiler) visitMacroStmt(stmt *Macro) interface{} {
+	return nil
+}
+
+func (c *Compiler) visitMacroCallExpr(m *MacroCall) interface{} {
+	return nil
+}
+
+// visitAssertStmt keeps the operands of a comparison on the stack so
+// that a failed assertion shows them like the Interpreter does
+func (c *Compiler) visitAssertStmt(stmt *Assert) interface{} {
+	if b, ok := stmt.condition.(*Binary); ok {
+		c.compileExpr(b.left)
+		c.compileExpr(b.right)
+	} else {
+		c.compileExpr(stmt.condition)
+	}
+	constant := c.makeConstant(stmt, stmt.keyword)
+	c.emitShort(OP_ASSERT, constant, stmt.keyword)
+	c.chunk().writeShort(0xffff, stmt.keyword)
+	end := len(c.chunk().code) - 2
+
+	if stmt.message != nil {
+		c.compileExpr(stmt.message)
+	}
+	c.emitShort(OP_ASSERT_FAIL, constant, stmt.keyword)
+	c.patchJump(end)
+	return nil
+}
+
+// visitTestStmt compiles test blocks which are only run in test mode
+func (c *Compiler) visitTestStmt(stmt *Test) interface{} {
+	c.compileTest(stmt)
+	return nil
+}
+
+func (c *Compiler) visitLiteralExpr(l *Literal) interface{} {
+	switch l.value {
+	case nil:
+		c.emit(OP_NIL, Token{})
+	case true:
+		c.emit(OP_TRUE, Token{})
+	case false:
+		c.emit(OP_FALSE, Token{})
+	default:
+		c.emitConstant(l.value, Token{})
+	}
+	return nil
+}
+
+func (c *Compiler) visitGroupingExpr(g *Grouping) interface{} {
+	c.compileExpr(g.expression)
+	return nil
+}
+
+func (c *Compiler) visitUnaryExpr(u *Unary) interface{} {
+	c.compileExpr(u.right)
+	if u.operator.typ == MINUS {
+		c.emit(OP_NEGATE, u.operator)
+	} else {
+		c.emit(OP_NOT, u.operator)
+	}
+	return nil
+}
+
+func (c *Compiler) visitBinaryExpr(b *Binary) interface{} {
+	c.compileExpr(b.left)
+	c.compileExpr(b.right)
+	c.emit(OP_BINARY, b.operator)
+	c.chunk().write(byte(b.operator.typ), b.operator)
+	return nil
+}
+
+func (c *Compiler) visitLogicalExpr(l *Logical) interface{} {
+	c.compileExpr(l.left)
+	if l.operator.typ == OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE, l.operator)
+		endJump := c.emitJump(OP_JUMP, l.operator)
+		c.patchJump(elseJump)
+		c.emit(OP_POP, l.operator)
+		c.compileExpr(l.right)
+		c.patchJump(endJump)
+	} else {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE, l.operator)
+		c.emit(OP_POP, l.operator)
+		c.compileExpr(l.right)
+		c.patchJump(endJump)
+	}
+	return nil
+}
+
+func (c *Compiler) visitVariableExpr(v *Variable) interface{} {
+	c.getVariable(v.name)
+	return nil
+}
+
+func (c *Compiler) visitAssignExpr(a *Assign) interface{} {
+	c.compileExpr(a.value)
+	c.setVariable(a.name)
+	return nil
+}
+
+func (c *Compiler) visitCallExpr(call *Call) interface{} {
+	c.compileExpr(call.callee)
+	for _, argument := range call.arguments {
+		c.compileExpr(argument)
+	}
+	c.emit(OP_CALL, call.paren)
+	c.chunk().write(byte(len(call.arguments)), call.paren)
+	return nil
+}
+
+func (c *Compiler) visitGetExpr(g *Get) interface{} {
+	if isPrivate(g.name.lexeme) {
+		c.unsupported(g.name, "private members")
+	}
+	c.compileExpr(g.object)
+	c.emitShort(OP_GET_PROPERTY, c.makeConstant(g.name.lexeme, g.name), g.name)
+	return nil
+}
+
+func (c *Compiler) visitSetExpr(s *Set) interface{} {
+	if isPrivate(s.name.lexeme) {
+		c.unsupported(s.name, "private members")
+	}
+	c.compileExpr(s.object)
+	// the object is checked before the value is evaluated
+	c.emit(OP_CHECK_INSTANCE, s.name)
+	c.compileExpr(s.value)
+	c.emitShort(OP_SET_PROPERTY, c.makeConstant(s.name.lexeme, s.name), s.name)
+	return nil
+}
+
+func (c *Compiler) visitSliceExpr(s *Slice) interface{} {
+	c.compileExpr(s.object)
+	for _, e := range []Expr{s.start, s.stop, s.step} {
+		if e == nil {
+			c.emit(OP_NIL, s.bracket)
+			continue
+		}
+		c.compileExpr(e)
+		c.emit(OP_SLICE_BOUND, s.bracket)
+	}
+	c.emit(OP_SLICE, s.bracket)
+	return nil
+}
+
+func (c *Compiler) visitThisExpr(t *This) interface{} {
+	c.getVariable(t.keyword)
+	return nil
+}
+
+func (c *Compiler) visitSuperExpr(s *Super) interface{} {
+	c.getVariable(Token{typ: THIS, lexeme: "this", line: s.keyword.line})
+	c.getVariable(s.keyword)
+	c.emitShort(OP_GET_SUPER, c.makeConstant(s.method.lexeme, s.method), s.method)
+	return nil
+}
+
+func (c *Compiler) visitAwaitExpr(a *Await) interface{} {
+	c.unsupported(a.keyword, "await expressions")
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+// LoxEnum implements LoxIterable
+type LoxEnum struct {
+	name    string
+	members []*LoxEnumMember
+}
+
+func NewLoxEnum(name string, members []Token) *LoxEnum {
+	enum := &LoxEnum{name, make([]*LoxEnumMember, len(members))}
+	for i, member := range members {
+		enum.members[i] = &LoxEnumMember{enum, member.lexeme, i}
+	}
+	return enum
+}
+
+func (l *LoxEnum) get(name Token) (interface{}, error) {
+	for _, member := range l.members {
+		if member.name == name.lexeme {
+			return member, nil
+		}
+	}
+
+	return nil, NewRuntimeError(name, "undefined member '"+name.lexeme+"' in enum '"+l.name+"'.")
+}
+
+func (l *LoxEnum) iterator() func() (interface{}, bool) {
+	i := 0
+	return func() (interface{}, bool) {
+		if i >= len(l.members) {
+			return nil, false
+		}
+		i++
+		return l.members[i-1], true
+	}
+}
+
+func (l *LoxEnum) String() string {
+	return l.name
+}
+
+// LoxEnumMember is a singleton value, members are compared by identity
+type LoxEnumMember struct {
+	enum    *LoxEnum
+	name    string
+	ordinal int
+}
+
+func (l *LoxEnumMember) get(name Token) (interface{}, error) {
+	switch name.lexeme {
+	case "name":
+		return l.name, nil
+	case "ordinal":
+		return float64(l.ordinal), nil
+	}
+
+	return nil, NewRuntimeError(name, "undefined property '"+name.lexeme+"'.")
+}
+
+func (l *LoxEnumMember) String() string {
+	return l.enum.name + "." + l.name
+}
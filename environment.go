@@ -1,61 +1,138 @@
 package main
 
+import (
+	"sync"
+)
+
+// Environment is the frame of a local scope, variables are stored in the slots
+// given to them by the resolver in the order they're declared
+// it's always shared through a pointer, closures keep a pointer to the
+// environment they were declared in and see later assignments to it
+// hoisted functions can use a variable before it's declared, so a slot
+// may be read or assigned before it's been defined and then holds nil
 type Environment struct {
-	values    map[string]interface{}
+	values    []interface{}
+	defined   int // the number of slots which have been defined
 	enclosing *Environment
+	lock      sync.RWMutex // environments can be shared by spawned tasks
 }
 
 func NewEnvironment(enclosing *Environment) *Environment {
-	return &Environment{
-		values:    map[string]interface{}{},
-		enclosing: enclosing,
-	}
+	return &Environment{enclosing: enclosing}
 }
 
-func (e Environment) define(name string, value interface{}) {
-	e.put(name, value)
+// define puts a value in the next slot and returns its index
+func (e *Environment) define(value interface{}) int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.grow(e.defined)
+	e.values[e.defined] = value
+	e.defined++
+	return e.defined - 1
+}
+
+// grow makes sure the frame has the given slot
+func (e *Environment) grow(slot int) {
+	for len(e.values) <= slot {
+		e.values = append(e.values, nil)
+	}
 }
 
-func (e Environment) ancestor(distance int) Environment {
+func (e *Environment) ancestor(distance int) *Environment {
 	environment := e
 	for i := 0; i < distance; i++ {
-		environment = *environment.enclosing
+		environment = environment.enclosing
 	}
 	return environment
 }
 
-func (e Environment) get(name Token) interface{} {
-	if elem, ok := e.values[name.lexeme]; ok {
-		return elem
-	}
-	if e.enclosing != nil {
-		return e.enclosing.get(name)
+func (e *Environment) getAt(distance int, slot int) interface{} {
+	return e.ancestor(distance).get(slot)
+}
+
+func (e *Environment) assignAt(distance int, slot int, value interface{}) {
+	e.ancestor(distance).put(slot, value)
+}
+
+func (e *Environment) get(slot int) interface{} {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if slot >= len(e.values) {
+		return nil
 	}
+	return e.values[slot]
+}
 
-	panic(NewRuntimeError(name, "undefined variable '"+name.lexeme+"'."))
+func (e *Environment) put(slot int, value interface{}) {
+	e.lock.Lock()
+	e.grow(slot)
+	e.values[slot] = value
+	e.lock.Unlock()
 }
 
-func (e Environment) getAt(distance int, name string) interface{} {
-	return e.ancestor(distance).values[name]
+// Globals is the table of global variables, the resolver gives each name an index
+// when it's first used so that variables are looked up without hashing their name
+// globals can be used before they're defined so an index may not hold a value yet
+type Globals struct {
+	indices map[string]int
+	values  []interface{}
+	defined []bool
+	lock    sync.RWMutex
 }
 
-func (e Environment) assign(name Token, value interface{}) {
-	if _, ok := e.values[name.lexeme]; ok {
-		e.put(name.lexeme, value)
-		return
-	}
-	if e.enclosing != nil {
-		e.enclosing.assign(name, value)
-		return
+func NewGlobals() *Globals {
+	return &Globals{indices: map[string]int{}}
+}
+
+// index returns the index of a global, adding an undefined one if needed
+func (g *Globals) index(name string) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if index, ok := g.indices[name]; ok {
+		return index
 	}
+	g.indices[name] = len(g.values)
+	g.values = append(g.values, nil)
+	g.defined = append(g.defined, false)
+	return len(g.values) - 1
+}
 
-	panic(NewRuntimeError(name, "undefined variable '"+name.lexeme+"'."))
+// define declares a global or redefines an existing one
+func (g *Globals) define(name string, value interface{}) {
+	index := g.index(name)
+	g.lock.Lock()
+	g.values[index] = value
+	g.defined[index] = true
+	g.lock.Unlock()
 }
 
-func (e Environment) assignAt(distance int, name Token, value interface{}) {
-	e.ancestor(distance).values[name.lexeme] = value
+// put defines the global with the given index
+func (g *Globals) put(index int, value interface{}) {
+	g.lock.Lock()
+	g.values[index] = value
+	g.defined[index] = true
+	g.lock.Unlock()
 }
 
-func (e Environment) put(name string, value interface{}) {
-	e.values[name] = value
+func (g *Globals) get(index int, name Token) (interface{}, error) {
+	g.lock.RLock()
+	value, ok := g.values[index], g.defined[index]
+	g.lock.RUnlock()
+	if !ok {
+		return nil, NewRuntimeError(name, "undefined variable '"+name.lexeme+"'.")
+	}
+	return value, nil
+}
+
+func (g *Globals) assign(index int, name Token, value interface{}) error {
+	g.lock.Lock()
+	ok := g.defined[index]
+	if ok {
+		g.values[index] = value
+	}
+	g.lock.Unlock()
+	if !ok {
+		return NewRuntimeError(name, "undefined variable '"+name.lexeme+"'.")
+	}
+	return nil
 }
@@ -2,11 +2,30 @@ package main
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
 // TODO: remove global vars
 var hadError = false
-var hadRuntimeError = false
+var hadRuntimeError atomicFlag // also set by tasks on other goroutines
+var hadTestFailure = false
+
+// atomicFlag is a boolean which can be set and read from several goroutines
+type atomicFlag struct {
+	value int32
+}
+
+func (f *atomicFlag) set(value bool) {
+	var v int32
+	if value {
+		v = 1
+	}
+	atomic.StoreInt32(&f.value, v)
+}
+
+func (f *atomicFlag) get() bool {
+	return atomic.LoadInt32(&f.value) == 1
+}
 
 func reporter(line int, where string, message string) string {
 	s := fmt.Sprintf("[line %v] Error %s: %s\n", line, where, message)
@@ -45,13 +64,43 @@ func (err ParseError) Error() string {
 	return reporter(t.line, "at '"+t.lexeme+"'", err.message)
 }
 
+// CallError is raised by callables which have no token to report the error at,
+// the interpreter reports it as a RuntimeError at the call site
+type CallError struct {
+	message string
+}
+
+func NewCallError(message string) error {
+	return &CallError{message}
+}
+
+func (err *CallError) Error() string {
+	return err.message
+}
+
+// TaskError reports a RuntimeError raised inside a spawned task
+type TaskError struct {
+	id       int32
+	keyword  Token // of the spawn statement
+	function LoxCallable
+	err      error
+}
+
+func NewTaskError(id int32, keyword Token, function LoxCallable, err error) error {
+	return &TaskError{id, keyword, function, err}
+}
+
+func (err *TaskError) Error() string {
+	return fmt.Sprintf("[task %d %v spawned at line %v] %v", err.id, err.function, err.keyword.line, err.err)
+}
+
 type RuntimeError struct {
 	token   Token
 	message string
 }
 
 func NewRuntimeError(token Token, message string) error {
-	hadRuntimeError = true
+	hadRuntimeError.set(true)
 	return &RuntimeError{token, message}
 }
 
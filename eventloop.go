@@ -0,0 +1,283 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// EventLoop runs the continuations of async functions and timer callbacks
+// after the main script, it's only driven by the main task
+type EventLoop struct {
+	lock     sync.Mutex // jobs and timers can be added by spawned tasks
+	jobs     []func()   // ready to run, e.g. resuming an async function
+	timers   timerQueue
+	byID     map[int]*timer
+	lastID   int
+	lastSeq  int
+	clock    Clock
+	rejected []*LoxPromise // since the last time jobs were drained
+}
+
+func NewEventLoop(clock Clock) *EventLoop {
+	return &EventLoop{clock: clock, byID: map[int]*timer{}}
+}
+
+// run drains the event loop, a RuntimeError in a callback or an
+// unhandled rejection stops it like an error in the main script
+func (l *EventLoop) run(interpreter *Interpreter) error {
+	for {
+		more, err := l.step(interpreter)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// step runs the next job or timer and returns false once there's nothing left to run
+// jobs are always drained before the clock moves on to the next timer
+func (l *EventLoop) step(interpreter *Interpreter) (bool, error) {
+	l.lock.Lock()
+	if len(l.jobs) > 0 {
+		job := l.jobs[0]
+		l.jobs = l.jobs[1:]
+		l.lock.Unlock()
+		job()
+		return true, nil
+	}
+
+	rejected := l.rejected
+	l.rejected = nil
+	for _, promise := range rejected {
+		if !promise.handled {
+			promise.handled = true
+			l.lock.Unlock()
+			return false, promise.err
+		}
+	}
+
+	for l.timers.Len() > 0 {
+		t := heap.Pop(&l.timers).(*timer)
+		if t.cancelled {
+			continue
+		}
+		if t.interval >= 0 {
+			t.due += t.interval
+			t.seq = l.nextSeq()
+			heap.Push(&l.timers, t)
+		} else {
+			delete(l.byID, t.id)
+		}
+		l.lock.Unlock()
+
+		l.clock.waitUntil(t.due)
+		return true, t.callback(interpreter)
+	}
+
+	l.lock.Unlock()
+	return false, nil
+}
+
+// pending returns true if the loop has jobs, timers or rejections left
+func (l *EventLoop) pending() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.jobs) > 0 || l.timers.Len() > 0 || len(l.rejected) > 0
+}
+
+// settle fulfills or rejects a promise and schedules its callbacks
+func (l *EventLoop) settle(promise *LoxPromise, value interface{}, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err != nil {
+		promise.state, promise.err = REJECTED, err
+		if !promise.handled {
+			l.rejected = append(l.rejected, promise)
+		}
+	} else {
+		promise.state, promise.value = FULFILLED, value
+	}
+
+	l.jobs = append(l.jobs, promise.callbacks...)
+	promise.callbacks = nil
+}
+
+// schedule adds a timer running after delay milliseconds,
+// and then every interval milliseconds unless interval is negative
+func (l *EventLoop) schedule(delay float64, interval float64, callback func(*Interpreter) error) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lastID++
+	t := &timer{l.lastID, l.clock.now() + delay, l.nextSeq(), interval, callback, false}
+	l.byID[t.id] = t
+	heap.Push(&l.timers, t)
+	return t.id
+}
+
+func (l *EventLoop) cancel(id int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if t, ok := l.byID[id]; ok {
+		t.cancelled = true
+		delete(l.byID, id)
+	}
+}
+
+func (l *EventLoop) nextSeq() int {
+	l.lastSeq++
+	return l.lastSeq
+}
+
+type timer struct {
+	id        int
+	due       float64 // in milliseconds on the loop's clock
+	seq       int     // timers due at the same time run in the order they were scheduled
+	interval  float64
+	callback  func(*Interpreter) error
+	cancelled bool
+}
+
+// timerQueue implements heap.Interface ordered by due time
+type timerQueue []*timer
+
+func (q timerQueue) Len() int {
+	return len(q)
+}
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].due == q[j].due {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due < q[j].due
+}
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	*q = append(*q, x.(*timer))
+}
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// Clock measures the time used by timers in milliseconds
+type Clock interface {
+	now() float64
+	// waitUntil returns once the clock reaches the given time
+	waitUntil(t float64)
+}
+
+type RealClock struct {
+	start time.Time
+}
+
+func NewRealClock() *RealClock {
+	return &RealClock{time.Now()}
+}
+
+func (c *RealClock) now() float64 {
+	return float64(time.Since(c.start)) / float64(time.Millisecond)
+}
+
+func (c *RealClock) waitUntil(t float64) {
+	if d := t - c.now(); d > 0 {
+		time.Sleep(time.Duration(d * float64(time.Millisecond)))
+	}
+}
+
+// VirtualClock jumps to the time of the next timer instead of sleeping
+// so that programs using timers can be tested quickly and deterministically
+type VirtualClock struct {
+	time float64
+}
+
+func (c *VirtualClock) now() float64 {
+	return c.time
+}
+
+func (c *VirtualClock) waitUntil(t float64) {
+	if t > c.time {
+		c.time = t
+	}
+}
+
+// defineTimerNatives adds the functions for scheduling work on the event loop
+func defineTimerNatives(globals *Globals) {
+	globals.define("setTimeout", NewNativeFunction("setTimeout", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		return scheduleCallback(interpreter, args, -1)
+	}))
+	globals.define("setInterval", NewNativeFunction("setInterval", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		interval, err := toDelay(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return scheduleCallback(interpreter, args, interval)
+	}))
+
+	clear := NewNativeFunction("clearTimeout", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		if id, ok := args[0].(float64); ok {
+			interpreter.loop.cancel(int(id))
+		}
+		return nil, nil
+	})
+	globals.define("clearTimeout", clear)
+	globals.define("clearInterval", clear)
+
+	// sleep returns a promise which is fulfilled after the delay
+	globals.define("sleep", NewNativeFunction("sleep", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		delay, err := toDelay(args[0])
+		if err != nil {
+			return nil, err
+		}
+		promise := NewLoxPromise()
+		interpreter.loop.schedule(delay, -1, func(i *Interpreter) error {
+			i.loop.settle(promise, nil, nil)
+			return nil
+		})
+		return promise, nil
+	}))
+
+	globals.define("now", NewNativeFunction("now", 0, func(interpreter *Interpreter, _ []interface{}) (interface{}, error) {
+		return interpreter.loop.clock.now(), nil
+	}))
+}
+
+// scheduleCallback adds a timer calling a function without arguments
+func scheduleCallback(interpreter *Interpreter, args []interface{}, interval float64) (interface{}, error) {
+	function, ok := args[0].(LoxCallable)
+	switch args[0].(type) {
+	case *LoxClass, *vmClass:
+		ok = false
+	}
+	if !ok || function.arity() != 0 {
+		return nil, NewCallError("callback must be a function without parameters")
+	}
+
+	delay, err := toDelay(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	id := interpreter.loop.schedule(delay, interval, func(i *Interpreter) error {
+		_, err := function.call(i, nil)
+		return err
+	})
+	return float64(id), nil
+}
+
+func toDelay(value interface{}) (float64, error) {
+	delay, ok := value.(float64)
+	if !ok || delay < 0 {
+		return 0, NewCallError("delay must be a non-negative number")
+	}
+	return delay, nil
+}
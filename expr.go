@@ -3,13 +3,16 @@ package main
 
 type ExprVisitor interface {
 	visitAssignExpr(*Assign) interface{}
+	visitAwaitExpr(*Await) interface{}
 	visitBinaryExpr(*Binary) interface{}
 	visitCallExpr(*Call) interface{}
 	visitGetExpr(*Get) interface{}
 	visitGroupingExpr(*Grouping) interface{}
 	visitLiteralExpr(*Literal) interface{}
 	visitLogicalExpr(*Logical) interface{}
+	visitMacroCallExpr(*MacroCall) interface{}
 	visitSetExpr(*Set) interface{}
+	visitSliceExpr(*Slice) interface{}
 	visitSuperExpr(*Super) interface{}
 	visitThisExpr(*This) interface{}
 	visitUnaryExpr(*Unary) interface{}
@@ -21,14 +24,24 @@ type Expr interface {
 }
 
 type Assign struct {
-	name  Token
-	value Expr
+	name    Token
+	value   Expr
+	binding Binding
 }
 
 func (a *Assign) accept(visitor ExprVisitor) interface{} {
 	return visitor.visitAssignExpr(a)
 }
 
+type Await struct {
+	keyword Token
+	value   Expr
+}
+
+func (a *Await) accept(visitor ExprVisitor) interface{} {
+	return visitor.visitAwaitExpr(a)
+}
+
 type Binary struct {
 	left     Expr
 	operator Token
@@ -84,6 +97,15 @@ func (l *Logical) accept(visitor ExprVisitor) interface{} {
 	return visitor.visitLogicalExpr(l)
 }
 
+type MacroCall struct {
+	name      Token
+	arguments []Stmt
+}
+
+func (m *MacroCall) accept(visitor ExprVisitor) interface{} {
+	return visitor.visitMacroCallExpr(m)
+}
+
 type Set struct {
 	object Expr
 	name   Token
@@ -94,9 +116,22 @@ func (s *Set) accept(visitor ExprVisitor) interface{} {
 	return visitor.visitSetExpr(s)
 }
 
+type Slice struct {
+	object  Expr
+	bracket Token
+	start   Expr
+	stop    Expr
+	step    Expr
+}
+
+func (s *Slice) accept(visitor ExprVisitor) interface{} {
+	return visitor.visitSliceExpr(s)
+}
+
 type Super struct {
 	keyword Token
 	method  Token
+	binding Binding
 }
 
 func (s *Super) accept(visitor ExprVisitor) interface{} {
@@ -105,6 +140,7 @@ func (s *Super) accept(visitor ExprVisitor) interface{} {
 
 type This struct {
 	keyword Token
+	binding Binding
 }
 
 func (t *This) accept(visitor ExprVisitor) interface{} {
@@ -121,7 +157,8 @@ func (u *Unary) accept(visitor ExprVisitor) interface{} {
 }
 
 type Variable struct {
-	name Token
+	name    Token
+	binding Binding
 }
 
 func (v *Variable) accept(visitor ExprVisitor) interface{} {
@@ -1,42 +1,59 @@
 package main
 
+import (
+	"fmt"
+)
+
 // LoxFunction implements LoxCallable
 type LoxFunction struct {
 	declaration Function
-	closure     Environment
+	closure     *Environment
 	isInit      bool
+	class       *LoxClass   // declaring class of a method
+	decorated   LoxCallable // of a decorated method, bound in its place
 }
 
 func NewLoxFunction(declaration *Function, closure *Environment, isInit bool) *LoxFunction {
-	return &LoxFunction{*declaration, *closure, isInit}
+	return &LoxFunction{*declaration, closure, isInit, nil, nil}
+}
+
+func (l *LoxFunction) call(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	if l.declaration.async {
+		return interpreter.startAsync(l, args), nil
+	}
+	return l.execute(interpreter, args)
 }
 
-func (l *LoxFunction) call(interpreter *Interpreter, args []interface{}) (ret interface{}) {
-	env := NewEnvironment(&l.closure)
+// execute runs the function body, async functions run it on a coroutine
+func (l *LoxFunction) execute(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	env := NewEnvironment(l.closure)
+
+	// parameters take the first slots
+	env.values = append([]interface{}{}, args...)
+	env.defined = len(args)
+	enclosingDeferred := interpreter.deferred
+	interpreter.deferred = nil
+
+	completion := interpreter.executeBlock(l.declaration.body, env)
+
+	// deferred calls run on every exit: normal completion, return or runtime error
+	// an error raised by a deferred call replaces the result of the function
+	deferred := interpreter.deferred
+	interpreter.deferred = enclosingDeferred
+	if err := interpreter.runDeferred(deferred); err != nil {
+		return nil, err
+	}
 
-	for i := 0; i < len(l.declaration.params); i++ {
-		env.define(l.declaration.params[i].lexeme, args[i])
+	if completion != nil && completion.typ == THROWING {
+		return nil, completion.err
 	}
-	// handle return statements
-	defer func() {
-		if err := recover(); err != nil {
-			if returnValue, ok := err.(ReturnT); ok {
-				if l.isInit {
-					ret = l.closure.getAt(0, "this")
-				} else {
-					ret = returnValue.value
-				}
-			} else {
-				panic(err)
-			}
-		}
-	}()
-
-	interpreter.executeBlock(l.declaration.body, env)
 	if l.isInit {
-		return l.closure.getAt(0, "this")
+		return l.closure.get(0), nil
+	}
+	if completion != nil {
+		return completion.value, nil
 	}
-	return nil
+	return nil, nil
 }
 
 func (l *LoxFunction) arity() int {
@@ -44,11 +61,57 @@ func (l *LoxFunction) arity() int {
 }
 
 func (l *LoxFunction) bind(instance *LoxInstance) *LoxFunction {
-	environment := NewEnvironment(&l.closure)
-	environment.define("this", instance)
+	return l.bindValue(instance)
+}
+
+// bindValue binds "this" to any value, used for methods added to builtin types
+func (l *LoxFunction) bindValue(value interface{}) *LoxFunction {
+	environment := NewEnvironment(l.closure)
+	environment.define(value)
+	environment.define(l.class)
 	return NewLoxFunction(&l.declaration, environment, l.isInit)
 }
 
 func (l *LoxFunction) String() string {
 	return "<fn " + l.declaration.name.lexeme + ">"
 }
+
+// unboundMethod implements LoxCallable, method decorators are called with it
+// once when the class is declared and it takes the instance as first argument
+type unboundMethod struct {
+	method *LoxFunction
+}
+
+func (u *unboundMethod) arity() int {
+	return u.method.arity() + 1
+}
+
+func (u *unboundMethod) call(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	return u.method.bindValue(args[0]).call(interpreter, args[1:])
+}
+
+func (u *unboundMethod) String() string {
+	return u.method.String()
+}
+
+// boundDecorated implements LoxCallable, it calls a decorated method with
+// the instance it was accessed on as first argument
+type boundDecorated struct {
+	receiver  interface{}
+	decorated LoxCallable
+}
+
+func (b *boundDecorated) arity() int {
+	if b.decorated.arity() == VARIADIC {
+		return VARIADIC
+	}
+	return b.decorated.arity() - 1
+}
+
+func (b *boundDecorated) call(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	return b.decorated.call(interpreter, append([]interface{}{b.receiver}, args...))
+}
+
+func (b *boundDecorated) String() string {
+	return fmt.Sprint(b.decorated)
+}
@@ -0,0 +1,15 @@
+package main
+
+// LoxInterface holds the method signatures that implementing classes must provide
+type LoxInterface struct {
+	name    string
+	methods map[string]int // arity of each method
+}
+
+func NewLoxInterface(name string, methods map[string]int) *LoxInterface {
+	return &LoxInterface{name, methods}
+}
+
+func (l *LoxInterface) String() string {
+	return l.name
+}
@@ -2,69 +2,125 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 )
 
 // Interpreter implements ExprVisitor, StmtVisitor
 type Interpreter struct {
-	env      *Environment
-	globals  *Environment
-	locals   map[Expr]int
+	env      *Environment // nil in top-level code
+	globals  *Globals
 	replMode bool
+	deferred []deferredCall // of the function being executed
+	tasks    *TaskGroup     // shared by the interpreters of spawned tasks
+	loop     *EventLoop
+	builtins map[string]*BuiltinType // method tables of primitive values
+	// of the async function being executed, nil in the main script and spawned tasks
+	coroutine *coroutine
 }
 
-func NewInterpreter(replMode bool) *Interpreter {
-	globals := NewEnvironment(nil)
-	env := *globals
-	locals := map[Expr]int{}
-	i := Interpreter{&env, globals, locals, replMode}
+func NewInterpreter(replMode bool, loop *EventLoop) *Interpreter {
+	globals := NewGlobals()
+	defineChannelNatives(globals)
+	defineTimerNatives(globals)
+	i := Interpreter{nil, globals, replMode, nil, NewTaskGroup(), loop, NewBuiltinTypes(), nil}
 	return &i
 }
 
 func (i *Interpreter) Interpret(statements []Stmt) {
-	defer func() {
-		if err := recover(); err != nil {
-			if iErr, ok := err.(*RuntimeError); ok {
-				fmt.Println(iErr)
-			} else {
-				panic(err)
-			}
-		}
-	}()
+	// spawned tasks finish before the next statements are resolved
+	defer i.tasks.wait()
+
 	for _, stmt := range statements {
-		if !i.replMode {
-			i.execute(stmt)
-		} else {
-			if v, ok := (stmt).(*Expression); ok {
-				fmt.Println(i.evaluate(v.expression))
-			} else {
-				i.execute(stmt)
-			}
+		if err := i.interpretStmt(stmt); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if err := i.runLoop(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// runLoop runs timers and async functions after the main script until
+// both the event loop and the spawned tasks, which can add timers, are done
+func (i *Interpreter) runLoop() error {
+	for {
+		if err := i.loop.run(i); err != nil {
+			return err
+		}
+		i.tasks.wait()
+		if !i.loop.pending() {
+			return nil
 		}
 	}
 }
 
-func (i *Interpreter) execute(s Stmt) {
-	s.accept(i)
+// interpretStmt executes a top-level statement, the REPL prints the value of expressions
+func (i *Interpreter) interpretStmt(stmt Stmt) error {
+	if v, ok := stmt.(*Expression); ok && i.replMode {
+		value, err := i.evaluate(v.expression)
+		if err == nil {
+			fmt.Println(stringify(value))
+		}
+		return err
+	}
+	if completion := i.execute(stmt); completion != nil {
+		return completion.err
+	}
+	return nil
 }
 
-func (i *Interpreter) resolve(expr Expr, depth int) {
-	i.locals[expr] = depth
+// execute returns how the statement completed, nil if it completed normally
+func (i *Interpreter) execute(s Stmt) *Completion {
+	completion, _ := s.accept(i).(*Completion)
+	return completion
 }
 
-func (i *Interpreter) evaluate(e Expr) interface{} {
-	return e.accept(i)
+// evaluate returns the value of an expression or the RuntimeError it raised,
+// expression visitors return the error in place of a value
+func (i *Interpreter) evaluate(e Expr) (interface{}, error) {
+	value := e.accept(i)
+	if err, ok := value.(*RuntimeError); ok {
+		return nil, err
+	}
+	return value, nil
+}
+
+// valueOrError returns what an expression visitor evaluates to, see evaluate
+func valueOrError(value interface{}, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return value
 }
 
 /*
  * ExprVisitor implementation
  */
 
+func (i *Interpreter) visitAwaitExpr(a *Await) interface{} {
+	value, err := i.evaluate(a.value)
+	if err != nil {
+		return err
+	}
+	if promise, ok := value.(*LoxPromise); ok {
+		return valueOrError(i.await(a.keyword, promise))
+	}
+	return value
+}
+
 func (i *Interpreter) visitLiteralExpr(l *Literal) interface{} {
 	return l.value
 }
 
 func (i *Interpreter) visitLogicalExpr(l *Logical) interface{} {
-	left := i.evaluate(l.left)
+	left, err := i.evaluate(l.left)
+	if err != nil {
+		return err
+	}
 
 	if l.operator.typ == OR {
 		if isTruthy(left) {
@@ -76,49 +132,172 @@ func (i *Interpreter) visitLogicalExpr(l *Logical) interface{} {
 			return left
 		}
 	}
-	return i.evaluate(l.right)
+	return valueOrError(i.evaluate(l.right))
 }
 
 func (i *Interpreter) visitSetExpr(s *Set) interface{} {
-	object := i.evaluate(s.object)
-	v, ok := object.(LoxInstance)
+	object, err := i.evaluate(s.object)
+	if err != nil {
+		return err
+	}
+	v, ok := object.(*LoxInstance)
 
 	if !ok {
-		panic(NewRuntimeError(s.name, "only instances have fields"))
+		return NewRuntimeError(s.name, "only instances have fields")
 	}
 
-	value := i.evaluate(s.value)
-	v.set(s.name, value)
-	return value
+	value, err := i.evaluate(s.value)
+	if err != nil {
+		return err
+	}
+	if isPrivate(s.name.lexeme) {
+		err = v.setPrivate(i, i.enclosingClass(s.object), s.name, value)
+	} else {
+		err = v.set(i, s.name, value)
+	}
+	return valueOrError(value, err)
+}
+
+// visitAssertStmt reports the source of a failed condition and the values
+// it was evaluated with, the operands of a comparison are shown separately
+func (i *Interpreter) visitAssertStmt(stmt *Assert) interface{} {
+	var value interface{}
+	var values string
+	var err error
+
+	if b, ok := stmt.condition.(*Binary); ok {
+		left, err := i.evaluate(b.left)
+		if err != nil {
+			return throw(err)
+		}
+		right, err := i.evaluate(b.right)
+		if err != nil {
+			return throw(err)
+		}
+		if value, err = i.evaluate(&Binary{&Literal{left}, b.operator, &Literal{right}}); err != nil {
+			return throw(err)
+		}
+		values = assertedValue(left) + " " + b.operator.lexeme + " " + assertedValue(right)
+	} else {
+		if value, err = i.evaluate(stmt.condition); err != nil {
+			return throw(err)
+		}
+		values = assertedValue(value)
+	}
+
+	if isTruthy(value) {
+		return nil
+	}
+
+	msg := "assertion failed: " + stmt.source + " (" + values + ")"
+	if stmt.message != nil {
+		message, err := i.evaluate(stmt.message)
+		if err != nil {
+			return throw(err)
+		}
+		msg += ": " + stringify(message)
+	}
+	return throw(NewRuntimeError(stmt.keyword, msg))
+}
+
+// assertedValue quotes strings so that they can be told apart from other values
+func assertedValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return stringify(value)
+}
+
+// visitTestStmt skips test blocks, they're run by RunTests in test mode
+func (i *Interpreter) visitTestStmt(stmt *Test) interface{} {
+	return nil
+}
+
+// macros are expanded and removed before interpreting
+func (i *Interpreter) visitMacroStmt(stmt *Macro) interface{} {
+	return nil
+}
+
+func (i *Interpreter) visitMacroCallExpr(m *MacroCall) interface{} {
+	return nil
+}
+
+func (i *Interpreter) visitSliceExpr(s *Slice) interface{} {
+	object, err := i.evaluate(s.object)
+	if err != nil {
+		return err
+	}
+
+	var bounds [3]*int
+	for j, e := range []Expr{s.start, s.stop, s.step} {
+		value, err := i.evaluateOptional(e)
+		if err != nil {
+			return err
+		}
+		if bounds[j], err = sliceBound(s.bracket, value); err != nil {
+			return err
+		}
+	}
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+
+	if step != nil && *step == 0 {
+		return NewRuntimeError(s.bracket, "slice step can't be zero")
+	}
+
+	str, ok := object.(string)
+	if !ok {
+		return NewRuntimeError(s.bracket, "only strings can be sliced")
+	}
+	return sliceString(str, start, stop, step)
+}
+
+// evaluateOptional evaluates to nil for parts left out of the syntax
+func (i *Interpreter) evaluateOptional(e Expr) (interface{}, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return i.evaluate(e)
 }
 
 func (i *Interpreter) visitSuperExpr(s *Super) interface{} {
-	distance := i.locals[s]
-	superclass := i.env.getAt(distance, "super").(*LoxClass)
-	object := (i.env.getAt(distance-1, "this")).(*LoxInstance)
+	distance := s.binding.depth
+	superclass := i.env.getAt(distance, s.binding.slot).(*LoxClass)
+	// "this" is only bound to instances in classes, see Resolver.visitSuperExpr
+	object, ok := i.env.getAt(distance-1, 0).(*LoxInstance)
+	if !ok {
+		return NewRuntimeError(s.keyword, "'super' can only be used with an instance")
+	}
 	method := superclass.findMethod(s.method.lexeme)
 	if method == nil {
+		if getter := superclass.findGetter(s.method.lexeme); getter != nil {
+			return valueOrError(getter.bind(object).call(i, nil))
+		}
 		msg := fmt.Sprintf("undefined property %q", s.method.lexeme)
-		panic(NewRuntimeError(s.method, msg))
+		return NewRuntimeError(s.method, msg)
 	}
-	return method.bind(object)
+	return object.bindMethod(method)
 }
 
 func (i *Interpreter) visitThisExpr(t *This) interface{} {
-	v := i.lookUpVariable(t.keyword, t).(*LoxInstance)
-	return *v
+	// "this" is a primitive value in extensions of builtin types
+	return valueOrError(i.lookUpVariable(t.keyword, t.binding))
 }
 
 func (i *Interpreter) visitGroupingExpr(g *Grouping) interface{} {
-	return i.evaluate(g.expression)
+	return valueOrError(i.evaluate(g.expression))
 }
 
 func (i *Interpreter) visitUnaryExpr(u *Unary) interface{} {
-	right := i.evaluate(u.right)
+	right, err := i.evaluate(u.right)
+	if err != nil {
+		return err
+	}
 
 	switch u.operator.typ {
 	case MINUS:
-		checkNumberOperand(u.operator, right)
+		if err := checkNumberOperand(u.operator, right); err != nil {
+			return err
+		}
 		return -(right).(float64)
 	case BANG:
 		return !isTruthy(right)
@@ -128,109 +307,196 @@ func (i *Interpreter) visitUnaryExpr(u *Unary) interface{} {
 }
 
 func (i *Interpreter) visitCallExpr(c *Call) interface{} {
-	callee := i.evaluate(c.callee)
+	function, arguments, err := i.evaluateCall(c)
+	if err != nil {
+		return err
+	}
+	return valueOrError(i.call(function, c.paren, arguments))
+}
+
+// evaluateCall evaluates the callee and arguments of a call without calling it
+func (i *Interpreter) evaluateCall(c *Call) (LoxCallable, []interface{}, error) {
+	callee, err := i.evaluate(c.callee)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	var arguments []interface{}
 
 	for _, a := range c.arguments {
-		arguments = append(arguments, i.evaluate(a))
+		argument, err := i.evaluate(a)
+		if err != nil {
+			return nil, nil, err
+		}
+		arguments = append(arguments, argument)
 	}
 
 	function, ok := callee.(LoxCallable)
 	if !ok {
-		panic(NewRuntimeError(c.paren, "can only call functions and classes"))
+		return nil, nil, NewRuntimeError(c.paren, "can only call functions and classes")
 	}
 
-	if len(arguments) != function.arity() {
-		msg := fmt.Sprintf("expected %d arguments but got %d", function.arity(), len(arguments))
-		panic(NewRuntimeError(c.paren, msg))
+	if err := checkArity(function, len(arguments), c.paren); err != nil {
+		return nil, nil, err
 	}
 
-	return function.call(i, arguments)
+	return function, arguments, nil
+}
+
+// call invokes a callable and reports a CallError at the given token
+func (i *Interpreter) call(function LoxCallable, paren Token, arguments []interface{}) (interface{}, error) {
+	value, err := function.call(i, arguments)
+	if cErr, ok := err.(*CallError); ok {
+		return nil, NewRuntimeError(paren, cErr.message)
+	}
+	return value, err
 }
 
 func (i *Interpreter) visitGetExpr(g *Get) interface{} {
-	object := i.evaluate(g.object)
+	object, err := i.evaluate(g.object)
+	if err != nil {
+		return err
+	}
 
-	if v, ok := object.(LoxInstance); ok {
-		return v.get(g.name)
+	switch v := object.(type) {
+	case *LoxInstance:
+		if isPrivate(g.name.lexeme) {
+			return valueOrError(v.getPrivate(i, i.enclosingClass(g.object), g.name))
+		}
+		return valueOrError(v.get(i, g.name))
+	case *LoxEnum:
+		return valueOrError(v.get(g.name))
+	case *LoxEnumMember:
+		return valueOrError(v.get(g.name))
 	}
 
-	panic(NewRuntimeError(g.name, "only instances have properties"))
+	if builtin, ok := i.builtins[builtinTypeName(object)]; ok {
+		return valueOrError(builtin.get(object, g.name))
+	}
+
+	return NewRuntimeError(g.name, "only instances have properties")
 }
 
 func (i *Interpreter) visitBinaryExpr(b *Binary) interface{} {
-	left := i.evaluate(b.left)
-	right := i.evaluate(b.right)
+	left, err := i.evaluate(b.left)
+	if err != nil {
+		return err
+	}
+	right, err := i.evaluate(b.right)
+	if err != nil {
+		return err
+	}
 
 	switch b.operator.typ {
+	case EQUAL_EQUAL, BANG_EQUAL:
+		equal, err := i.equals(left, right)
+		if err != nil {
+			return err
+		}
+		return equal == (b.operator.typ == EQUAL_EQUAL)
+	case IS:
+		class, ok := right.(*LoxClass)
+		if !ok {
+			return NewRuntimeError(b.operator, "right operand of 'is' must be a class")
+		}
+		instance, ok := left.(*LoxInstance)
+		return ok && instance.class.isSubclassOf(class)
+	}
+
+	return valueOrError(arithmetic(b.operator, left, right))
+}
+
+// arithmetic applies the binary operators on numbers and strings,
+// it's shared with the VM so that both raise the same errors
+func arithmetic(operator Token, left interface{}, right interface{}) (interface{}, error) {
+	switch operator.typ {
+	case MINUS, SLASH, STAR, GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		if err := checkNumberOperands(operator, left, right); err != nil {
+			return nil, err
+		}
+	}
+
+	switch operator.typ {
 	case PLUS:
 		if l, ok := left.(float64); ok {
 			if r, ok := right.(float64); ok {
-				return l + r
+				return l + r, nil
 			} else if r, ok := right.(string); ok {
-				return fmt.Sprint(l) + r
+				return stringify(l) + r, nil
 			}
 		}
 		if l, ok := left.(string); ok {
 			if r, ok := right.(string); ok {
-				return l + r
+				return l + r, nil
 			} else if r, ok := right.(float64); ok {
-				return l + fmt.Sprint(r)
+				return l + stringify(r), nil
 			}
 		}
-		panic(NewRuntimeError(b.operator, "operand must be a number or a string"))
+		return nil, NewRuntimeError(operator, "operand must be a number or a string")
 	case MINUS:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) - right.(float64)
+		return left.(float64) - right.(float64), nil
 	case SLASH:
-		checkNumberOperands(b.operator, left, right)
 		// returns +Inf or -Inf on division by zero since all numbers are float64
-		return left.(float64) / right.(float64)
+		return left.(float64) / right.(float64), nil
 	case STAR:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) * right.(float64)
+		return left.(float64) * right.(float64), nil
 	case GREATER:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) > right.(float64)
+		return left.(float64) > right.(float64), nil
 	case GREATER_EQUAL:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) >= right.(float64)
+		return left.(float64) >= right.(float64), nil
 	case LESS:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) < right.(float64)
+		return left.(float64) < right.(float64), nil
 	case LESS_EQUAL:
-		checkNumberOperands(b.operator, left, right)
-		return left.(float64) <= right.(float64)
-	case EQUAL_EQUAL:
-		return isEqual(left, right)
-	case BANG_EQUAL:
-		return !isEqual(left, right)
+		return left.(float64) <= right.(float64), nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (i *Interpreter) visitAssignExpr(a *Assign) interface{} {
-	value := i.evaluate(a.value)
-	if distance, ok := i.locals[a]; ok {
-		i.env.assignAt(distance, a.name, value)
-	} else {
-		i.globals.assign(a.name, value)
+	value, err := i.evaluate(a.value)
+	if err != nil {
+		return err
+	}
+	if a.binding.local {
+		i.env.assignAt(a.binding.depth, a.binding.slot, value)
+	} else if err := i.globals.assign(a.binding.slot, a.name, value); err != nil {
+		return err
 	}
 	return value
 }
 
 func (i *Interpreter) visitVariableExpr(v *Variable) interface{} {
-	return i.lookUpVariable(v.name, v)
+	return valueOrError(i.lookUpVariable(v.name, v.binding))
 }
 
-func (i *Interpreter) lookUpVariable(name Token, expr Expr) interface{} {
-	if distance, ok := i.locals[expr]; ok {
-		return i.env.getAt(distance, name.lexeme)
+// enclosingClass returns the class declaring the method in which "this" is used
+func (i *Interpreter) enclosingClass(object Expr) *LoxClass {
+	if t, ok := object.(*This); ok {
+		if t.binding.local {
+			class, _ := i.env.getAt(t.binding.depth, t.binding.slot+1).(*LoxClass)
+			return class
+		}
 	}
+	return nil
+}
 
-	return i.globals.get(name)
+func (i *Interpreter) lookUpVariable(name Token, binding Binding) (interface{}, error) {
+	if binding.local {
+		return i.env.getAt(binding.depth, binding.slot), nil
+	}
+
+	return i.globals.get(binding.slot, name)
+}
+
+// define declares a variable in the current scope and returns its slot,
+// globals are defined by name and have no slot
+func (i *Interpreter) define(name Token, value interface{}) int {
+	if i.env == nil {
+		i.globals.define(name.lexeme, value)
+		return -1
+	}
+	return i.env.define(value)
 }
 
 func isTruthy(v interface{}) bool {
@@ -244,78 +510,305 @@ func isTruthy(v interface{}) bool {
 	}
 }
 
+// stringify converts a value to the text shown by print, concatenation and the REPL
+// integer-valued numbers print without a decimal point or exponent like in jlox
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// equals implements ==, a class can override it with an equals(other) method
+func (i *Interpreter) equals(a interface{}, b interface{}) (bool, error) {
+	if l, ok := a.(*LoxInstance); ok {
+		if method := l.class.findMethod("equals"); method != nil && method.arity() == 1 {
+			value, err := method.bind(l).call(i, []interface{}{b})
+			return isTruthy(value), err
+		}
+	}
+	return isEqual(a, b), nil
+}
+
+// isEqual compares instances by identity and everything else by value
 func isEqual(a interface{}, b interface{}) bool {
+	// records are compared by value
+	if l, ok := a.(*LoxInstance); ok && l.class.record != nil {
+		r, ok := b.(*LoxInstance)
+		return ok && l.recordEquals(r)
+	}
 	return a == b
 }
 
-func checkNumberOperand(operator Token, value interface{}) {
+func checkNumberOperand(operator Token, value interface{}) error {
 	if _, ok := value.(float64); ok {
-		return
+		return nil
 	}
-	panic(NewRuntimeError(operator, "operand must be a number"))
+	return NewRuntimeError(operator, "operand must be a number")
 }
 
-func checkNumberOperands(operator Token, left interface{}, right interface{}) {
-	checkNumberOperand(operator, left)
-	checkNumberOperand(operator, right)
+func checkNumberOperands(operator Token, left interface{}, right interface{}) error {
+	if err := checkNumberOperand(operator, left); err != nil {
+		return err
+	}
+	return checkNumberOperand(operator, right)
 }
 
 /*
  * StmtVisitor implementation
  */
 
+// Completion is how a statement finished executing when it didn't complete
+// normally, it's propagated up through the enclosing statements until a
+// function call, loop or the top-level handles it
+type Completion struct {
+	typ   completionType
+	value interface{} // of a return statement
+	label string      // of a break or continue statement, empty for the innermost loop
+	err   error       // RuntimeError of a throw
+}
+
+type completionType int
+
+const (
+	RETURNING completionType = iota
+	BREAKING
+	CONTINUING
+	THROWING
+)
+
+// throw returns the completion of a statement which raised a RuntimeError
+func throw(err error) *Completion {
+	return &Completion{typ: THROWING, err: err}
+}
+
 func (i *Interpreter) visitExpressionStmt(stmt *Expression) interface{} {
-	i.evaluate(stmt.expression)
+	if _, err := i.evaluate(stmt.expression); err != nil {
+		return throw(err)
+	}
 	return nil
 }
 
 func (i *Interpreter) visitPrintStmt(stmt *Print) interface{} {
-	v := i.evaluate(stmt.expression)
-	fmt.Println(v)
+	v, err := i.evaluate(stmt.expression)
+	if err != nil {
+		return throw(err)
+	}
+	fmt.Println(stringify(v))
 	return nil
 }
 
-type ReturnT struct {
-	value interface{}
-}
-
 func (i *Interpreter) visitReturnStmt(stmt *Return) interface{} {
 	value := (interface{})(nil)
 	if stmt.value != nil {
-		value = i.evaluate(stmt.value)
+		v, err := i.evaluate(stmt.value)
+		if err != nil {
+			return throw(err)
+		}
+		value = v
 	}
-	panic(ReturnT{value})
+	return &Completion{typ: RETURNING, value: value}
+}
+
+type deferredCall struct {
+	function  LoxCallable
+	paren     Token
+	arguments []interface{}
 }
 
-type BreakT struct{}
+func (i *Interpreter) visitDeferStmt(stmt *Defer) interface{} {
+	// the callee and arguments are evaluated now, the call runs when the function exits
+	function, arguments, err := i.evaluateCall(stmt.call)
+	if err != nil {
+		return throw(err)
+	}
+	i.deferred = append(i.deferred, deferredCall{function, stmt.call.paren, arguments})
+	return nil
+}
 
-func (i *Interpreter) visitBreakStmt(_ *Break) interface{} {
-	panic(BreakT{})
+// runDeferred makes deferred calls in LIFO order
+// the remaining calls still run if one of them raises an error,
+// the error raised last is returned
+func (i *Interpreter) runDeferred(calls []deferredCall) error {
+	var err error
+	for j := len(calls) - 1; j >= 0; j-- {
+		if _, callErr := i.call(calls[j].function, calls[j].paren, calls[j].arguments); callErr != nil {
+			err = callErr
+		}
+	}
+	return err
+}
+
+func (i *Interpreter) visitSpawnStmt(stmt *Spawn) interface{} {
+	// the callee and arguments are evaluated before the task starts
+	function, arguments, err := i.evaluateCall(stmt.call)
+	if err != nil {
+		return throw(err)
+	}
+	i.spawn(stmt.keyword, function, stmt.call.paren, arguments)
+	return nil
+}
+
+func (i *Interpreter) visitSelectStmt(stmt *Select) interface{} {
+	cases := make([]reflect.SelectCase, 0, len(stmt.cases)+1)
+
+	for _, c := range stmt.cases {
+		value, err := i.evaluate(c.channel)
+		if err != nil {
+			return throw(err)
+		}
+		channel, ok := value.(*LoxChannel)
+		if !ok {
+			return throw(NewRuntimeError(c.operation, "argument must be a channel"))
+		}
+
+		if c.operation.lexeme == "send" {
+			value, err := i.evaluate(c.value)
+			if err != nil {
+				return throw(err)
+			}
+			cases = append(cases, reflect.SelectCase{
+				Dir:  reflect.SelectSend,
+				Chan: reflect.ValueOf(channel.values),
+				Send: reflect.ValueOf(&value).Elem(),
+			})
+		} else {
+			cases = append(cases, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(channel.values),
+			})
+		}
+	}
+
+	// without an else case select waits for a channel to be ready
+	if stmt.fallback != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	chosen, value, err := chooseCase(stmt.keyword, i.tasks, cases)
+	if err != nil {
+		return throw(err)
+	}
+	if chosen == len(stmt.cases) {
+		return i.execute(stmt.fallback)
+	}
+
+	c := stmt.cases[chosen]
+	env := NewEnvironment(i.env)
+	if c.name != (Token{}) {
+		env.define(value)
+	}
+	return i.executeBlock(c.body, env)
+}
+
+// break and continue statements end at the loop with a matching label
+// or at the innermost loop if the label is empty
+func (i *Interpreter) visitBreakStmt(stmt *Break) interface{} {
+	return &Completion{typ: BREAKING, label: stmt.label.lexeme}
+}
+
+func (i *Interpreter) visitContinueStmt(stmt *Continue) interface{} {
+	return &Completion{typ: CONTINUING, label: stmt.label.lexeme}
+}
+
+// targets returns true if a jump to the given label ends at a loop with the own label
+func targets(jump string, own Token) bool {
+	return jump == "" || jump == own.lexeme
+}
+
+// endLoop returns the completion of a loop whose body didn't complete normally,
+// a matching break statement stops the loop normally
+func endLoop(completion *Completion, label Token) *Completion {
+	if completion.typ == BREAKING && targets(completion.label, label) {
+		return nil
+	}
+	return completion
+}
+
+// executeLoopBody runs one iteration, a matching continue statement ends it early
+func (i *Interpreter) executeLoopBody(body Stmt, label Token, environment *Environment) *Completion {
+	previous := i.env
+
+	defer func() { i.env = previous }()
+
+	i.env = environment
+	completion := i.execute(body)
+	if completion != nil && completion.typ == CONTINUING && targets(completion.label, label) {
+		return nil
+	}
+	return completion
 }
 
 func (i *Interpreter) visitIfStmt(stmt *If) interface{} {
-	if isTruthy(i.evaluate(stmt.condition)) {
-		i.execute(stmt.thenBranch)
+	condition, err := i.evaluate(stmt.condition)
+	if err != nil {
+		return throw(err)
+	}
+	if isTruthy(condition) {
+		return i.execute(stmt.thenBranch)
 	} else {
 		if stmt.elseBranch != nil {
-			i.execute(stmt.elseBranch)
+			return i.execute(stmt.elseBranch)
 		}
 	}
 	return nil
 }
 
 func (i *Interpreter) visitWhileStmt(stmt *While) interface{} {
-	// handle break statement
-	defer func() {
-		if err := recover(); err != nil {
-			if _, ok := err.(BreakT); !ok {
-				panic(err)
+	for {
+		condition, err := i.evaluate(stmt.condition)
+		if err != nil {
+			return throw(err)
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+		if completion := i.executeLoopBody(stmt.body, stmt.label, i.env); completion != nil {
+			return endLoop(completion, stmt.label)
+		}
+		if stmt.increment != nil {
+			if _, err := i.evaluate(stmt.increment); err != nil {
+				return throw(err)
 			}
 		}
-	}()
+	}
+}
+
+func (i *Interpreter) visitForInStmt(stmt *ForIn) interface{} {
+	value, err := i.evaluate(stmt.iterable)
+	if err != nil {
+		return throw(err)
+	}
+	iterable, ok := value.(LoxIterable)
+	if !ok {
+		return throw(NewRuntimeError(stmt.keyword, "can only iterate over enums"))
+	}
 
-	for isTruthy(i.evaluate(stmt.condition)) {
-		i.execute(stmt.body)
+	next := iterable.iterator()
+	for value, ok := next(); ok; value, ok = next() {
+		// every iteration gets a fresh variable so closures capture its value
+		environment := NewEnvironment(i.env)
+		environment.define(value)
+		if completion := i.executeLoopBody(stmt.body, stmt.label, environment); completion != nil {
+			return endLoop(completion, stmt.label)
+		}
 	}
 	return nil
 }
@@ -325,69 +818,325 @@ func (i *Interpreter) visitVarStmt(stmt *Var) interface{} {
 	var value interface{}
 
 	if stmt.initializer != nil {
-		value = i.evaluate(stmt.initializer)
+		v, err := i.evaluate(stmt.initializer)
+		if err != nil {
+			return throw(err)
+		}
+		value = v
 	}
 
-	i.env.define(stmt.name.lexeme, value)
+	i.define(stmt.name, value)
 	return nil
 }
 
 func (i *Interpreter) visitBlockStmt(stmt *Block) interface{} {
-	i.executeBlock(stmt.statements, NewEnvironment(i.env))
-	return nil
+	return i.executeBlock(stmt.statements, NewEnvironment(i.env))
 }
 
 func (i *Interpreter) visitFunctionStmt(stmt *Function) interface{} {
+	decorators, err := i.evaluateAll(stmt.decorators)
+	if err != nil {
+		return throw(err)
+	}
 	function := NewLoxFunction(stmt, i.env, false)
-	i.env.define(stmt.name.lexeme, function)
+	value, err := i.decorate(decorators, stmt.name, function)
+	if err != nil {
+		return throw(err)
+	}
+	i.define(stmt.name, value)
 	return nil
 }
 
 func (i *Interpreter) visitClassStmt(stmt *Class) interface{} {
+	decorators, err := i.evaluateAll(stmt.decorators)
+	if err != nil {
+		return throw(err)
+	}
+
 	var superclass interface{}
 
 	hasSuperclass := stmt.superclass != (Variable{})
 
 	if hasSuperclass {
-		superclass = i.evaluate(&stmt.superclass)
+		if superclass, err = i.evaluate(&stmt.superclass); err != nil {
+			return throw(err)
+		}
 		if _, ok := superclass.(*LoxClass); !ok {
-			panic(NewRuntimeError(stmt.superclass.name, "superclass must be a class"))
+			return throw(NewRuntimeError(stmt.superclass.name, "superclass must be a class"))
 		}
 	}
 
-	i.env.define(stmt.name.lexeme, nil)
+	slot := i.define(stmt.name, nil)
 
+	previous := i.env
 	if hasSuperclass {
 		i.env = NewEnvironment(i.env)
-		i.env.define("super", superclass)
+		i.env.define(superclass)
 	}
 
+	s, _ := superclass.(*LoxClass)
+	class, err := i.createClass(stmt, s)
+	i.env = previous
+	if err != nil {
+		return throw(err)
+	}
+
+	value, err := i.decorate(decorators, stmt.name, class)
+	if err != nil {
+		return throw(err)
+	}
+	if slot < 0 {
+		i.globals.define(stmt.name.lexeme, value)
+	} else {
+		i.env.put(slot, value)
+	}
+	return nil
+}
+
+// createClass creates the class declared by a class statement,
+// its methods close over the current environment
+func (i *Interpreter) createClass(stmt *Class, superclass *LoxClass) (*LoxClass, error) {
 	methods := map[string]LoxFunction{}
+	getters := map[string]LoxFunction{}
+	setters := map[string]LoxFunction{}
+	abstract := map[string]int{}
+
+	for _, method := range stmt.abstracts {
+		abstract[method.name.lexeme] = len(method.params)
+	}
+
+	for _, v := range stmt.interfaces {
+		value, err := i.evaluate(&v)
+		if err != nil {
+			return nil, err
+		}
+		iface, ok := value.(*LoxInterface)
+		if !ok {
+			return nil, NewRuntimeError(v.name, "can only implement interfaces")
+		}
+		for name, arity := range iface.methods {
+			if _, ok := abstract[name]; !ok {
+				abstract[name] = arity
+			}
+		}
+	}
+
+	class := NewLoxClass(stmt.name.lexeme, superclass, methods, getters, setters, abstract, stmt.fields, i.env)
 
 	for _, method := range stmt.methods {
 		isInit := method.name.lexeme == "init"
-		function := NewLoxFunction(&method, i.env, isInit)
+		function := i.newMethod(&method, class, isInit)
+		if len(method.decorators) > 0 {
+			decorated, err := i.decorateMethod(&method, function)
+			if err != nil {
+				return nil, err
+			}
+			function.decorated = decorated
+		}
 		methods[method.name.lexeme] = *function
 	}
 
-	if hasSuperclass {
-		i.env = i.env.enclosing
+	for _, getter := range stmt.getters {
+		getters[getter.name.lexeme] = *i.newMethod(&getter, class, false)
 	}
 
-	s, _ := superclass.(*LoxClass)
-	class := NewLoxClass(stmt.name.lexeme, s, methods)
-	i.env.assign(stmt.name, class)
+	for _, setter := range stmt.setters {
+		setters[setter.name.lexeme] = *i.newMethod(&setter, class, false)
+	}
+
+	if err := i.mixTraits(stmt, class); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+func (i *Interpreter) evaluateAll(exprs []Expr) ([]interface{}, error) {
+	values := make([]interface{}, len(exprs))
+	for j, expr := range exprs {
+		value, err := i.evaluate(expr)
+		if err != nil {
+			return nil, err
+		}
+		values[j] = value
+	}
+	return values, nil
+}
+
+// decorateMethod applies the decorators of a method to it once when its class is
+// declared, the result is called with the instance as first argument
+func (i *Interpreter) decorateMethod(declaration *Function, method *LoxFunction) (LoxCallable, error) {
+	decorators, err := i.evaluateAll(declaration.decorators)
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.decorate(decorators, declaration.name, &unboundMethod{method})
+	if err != nil {
+		return nil, err
+	}
+	decorated, ok := value.(LoxCallable)
+	if !ok || decorated.arity() == 0 {
+		return nil, NewRuntimeError(declaration.name, "a decorated method must take the instance as its first argument")
+	}
+	return decorated, nil
+}
+
+// decorate applies decorators bottom-up and returns the value to bind to the name
+func (i *Interpreter) decorate(decorators []interface{}, name Token, value interface{}) (interface{}, error) {
+	for j := len(decorators) - 1; j >= 0; j-- {
+		decorator, ok := decorators[j].(LoxCallable)
+		if !ok {
+			return nil, NewRuntimeError(name, "decorators must be functions or classes")
+		}
+		if decorator.arity() != 1 {
+			return nil, NewRuntimeError(name, "decorators must take exactly one argument")
+		}
+		var err error
+		if value, err = i.call(decorator, name, []interface{}{value}); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// visitExtensionStmt adds methods to a builtin type or a class, extension
+// methods aren't part of the class so they can't use its private members
+func (i *Interpreter) visitExtensionStmt(stmt *Extension) interface{} {
+	name := stmt.target.name
+
+	if builtin, ok := i.builtins[name.lexeme]; ok {
+		for _, method := range stmt.methods {
+			if !builtin.extend(method.name.lexeme, *NewLoxFunction(&method, i.env, false)) {
+				return throw(NewRuntimeError(method.name, "type '"+name.lexeme+"' already has a method '"+method.name.lexeme+"'."))
+			}
+		}
+		return nil
+	}
+
+	target, err := i.evaluate(&stmt.target)
+	if err != nil {
+		return throw(err)
+	}
+	class, ok := target.(*LoxClass)
+	if !ok {
+		return throw(NewRuntimeError(name, "can only extend classes and builtin types"))
+	}
+
+	for _, method := range stmt.methods {
+		if !class.extend(method.name.lexeme, *NewLoxFunction(&method, i.env, false)) {
+			return throw(NewRuntimeError(method.name, "class '"+class.name+"' already has a member '"+method.name.lexeme+"'."))
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) visitTraitStmt(stmt *Trait) interface{} {
+	methods := map[string]LoxFunction{}
+
+	for _, method := range stmt.methods {
+		isInit := method.name.lexeme == "init"
+		methods[method.name.lexeme] = *NewLoxFunction(&method, i.env, isInit)
+	}
+
+	i.define(stmt.name, NewLoxTrait(stmt.name.lexeme, methods))
+	return nil
+}
+
+func (i *Interpreter) visitInterfaceStmt(stmt *Interface) interface{} {
+	methods := map[string]int{}
+
+	for _, method := range stmt.methods {
+		methods[method.name.lexeme] = len(method.params)
+	}
+
+	i.define(stmt.name, NewLoxInterface(stmt.name.lexeme, methods))
+	return nil
+}
+
+func (i *Interpreter) visitRecordStmt(stmt *Record) interface{} {
+	empty := map[string]LoxFunction{}
+	class := NewLoxClass(stmt.name.lexeme, nil, empty, empty, empty, map[string]int{}, nil, i.env)
+	class.record = stmt
+	i.define(stmt.name, class)
+	return nil
+}
+
+func (i *Interpreter) visitEnumStmt(stmt *Enum) interface{} {
+	i.define(stmt.name, NewLoxEnum(stmt.name.lexeme, stmt.members))
+	return nil
+}
+
+// mixTraits copies trait methods into the class method table
+// methods declared by the class itself take precedence over trait methods
+func (i *Interpreter) mixTraits(stmt *Class, class *LoxClass) error {
+	providers := map[string]*LoxTrait{}
+
+	for _, t := range stmt.traits {
+		value, err := i.evaluate(&t)
+		if err != nil {
+			return err
+		}
+		trait, ok := value.(*LoxTrait)
+		if !ok {
+			return NewRuntimeError(t.name, "can only mix in traits")
+		}
+
+		for name, method := range trait.methods {
+			if other, ok := providers[name]; ok {
+				msg := fmt.Sprintf("method '%s' is provided by both '%s' and '%s'", name, other.name, trait.name)
+				return NewRuntimeError(stmt.name, msg)
+			}
+			if class.hasMember(name) {
+				continue
+			}
+			providers[name] = trait
+			method.class = class
+			class.methods[name] = method
+		}
+	}
 	return nil
 }
 
-func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) {
+// newMethod creates a function declared in the body of the given class
+func (i *Interpreter) newMethod(declaration *Function, class *LoxClass, isInit bool) *LoxFunction {
+	function := NewLoxFunction(declaration, i.env, isInit)
+	function.class = class
+	return function
+}
+
+// evaluateIn evaluates an expression inside the given environment
+func (i *Interpreter) evaluateIn(expr Expr, environment *Environment) (interface{}, error) {
 	previous := i.env
 
 	defer func() { i.env = previous }()
 
 	i.env = environment
+	return i.evaluate(expr)
+}
 
+// executeBlock returns the completion of the first statement which didn't complete normally
+func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) *Completion {
+	previous := i.env
+
+	defer func() { i.env = previous }()
+
+	i.env = environment
+
+	// see Resolver.hoist
 	for _, statement := range statements {
-		i.execute(statement)
+		if f, ok := statement.(*Function); ok && isHoisted(f) {
+			if completion := i.execute(f); completion != nil {
+				return completion
+			}
+		}
 	}
+
+	for _, statement := range statements {
+		if f, ok := statement.(*Function); ok && isHoisted(f) {
+			continue
+		}
+		if completion := i.execute(statement); completion != nil {
+			return completion
+		}
+	}
+	return nil
 }
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// maxMacroDepth limits nested expansions so that recursive macros are reported
+// instead of expanding forever
+const maxMacroDepth = 64
+
+// MacroExpander implements ExprVisitor, StmtVisitor
+// it copies the AST replacing macro calls with their expansions, macro declarations
+// are removed from the output and remembered across calls to Expand
+//
+// names declared inside a macro body are renamed on each expansion so that
+// they can't capture or shadow the variables of the caller
+type MacroExpander struct {
+	macros     map[string]*Macro
+	expansions int // numbers the names declared by each expansion
+	depth      int
+	bindings   map[string]Stmt   // parameters of the current expansion, Expression or Block
+	renames    map[string]string // names declared by the current expansion
+	labels     map[string]string // labels declared by the current expansion
+}
+
+func NewMacroExpander() *MacroExpander {
+	return &MacroExpander{macros: map[string]*Macro{}}
+}
+
+// Expand runs before resolving, macros must be declared at top-level before being used
+func (m *MacroExpander) Expand(statements []Stmt) []Stmt {
+	expanded := []Stmt{}
+	for _, stmt := range statements {
+		if macro, ok := stmt.(*Macro); ok {
+			m.define(macro)
+			continue
+		}
+		expanded = append(expanded, m.stmt(stmt))
+	}
+	return expanded
+}
+
+func (m *MacroExpander) define(macro *Macro) {
+	seen := map[string]bool{}
+	for _, param := range macro.params {
+		if seen[param.lexeme] {
+			fmt.Println(NewParseError(param, "already a parameter with this name in this macro"))
+		}
+		seen[param.lexeme] = true
+	}
+	m.macros[macro.name.lexeme] = macro
+}
+
+// expand returns the body of the macro with the parameters replaced by the arguments
+func (m *MacroExpander) expand(call *MacroCall) []Stmt {
+	macro, ok := m.macros[call.name.lexeme]
+	if !ok {
+		fmt.Println(NewParseError(call.name, "undefined macro '"+call.name.lexeme+"'"))
+		return nil
+	}
+	if len(call.arguments) != len(macro.params) {
+		msg := fmt.Sprintf("expected %d arguments but got %d", len(macro.params), len(call.arguments))
+		fmt.Println(NewParseError(call.name, msg))
+		return nil
+	}
+	if m.depth >= maxMacroDepth {
+		fmt.Println(NewParseError(call.name, "macro expansion is too deep"))
+		return nil
+	}
+
+	// arguments belong to the caller so they're expanded before switching to the macro
+	bindings := map[string]Stmt{}
+	for i, argument := range call.arguments {
+		if expr, ok := argument.(*Expression); ok {
+			bindings[macro.params[i].lexeme] = &Expression{m.expr(expr.expression)}
+		} else {
+			bindings[macro.params[i].lexeme] = m.stmt(argument)
+		}
+	}
+
+	enclosingBindings, enclosingRenames, enclosingLabels := m.bindings, m.renames, m.labels
+
+	m.expansions++
+	m.bindings = bindings
+	m.renames, m.labels = map[string]string{}, map[string]string{}
+	suffix := "%" + strconv.Itoa(m.expansions)
+	for _, name := range declaredNames(macro.body, nil) {
+		m.renames[name] = name + suffix
+	}
+	for _, label := range declaredLabels(macro.body, nil) {
+		m.labels[label] = label + suffix
+	}
+
+	m.depth++
+	body := m.stmts(macro.body)
+	m.depth--
+
+	m.bindings, m.renames, m.labels = enclosingBindings, enclosingRenames, enclosingLabels
+	return body
+}
+
+// fragment returns a copy of an argument each time it's used
+// since the resolver tells expressions apart by their address
+func (m *MacroExpander) fragment(argument Stmt) Stmt {
+	enclosingBindings, enclosingRenames, enclosingLabels := m.bindings, m.renames, m.labels
+	m.bindings, m.renames, m.labels = nil, nil, nil
+
+	copied := m.stmt(argument)
+
+	m.bindings, m.renames, m.labels = enclosingBindings, enclosingRenames, enclosingLabels
+	return copied
+}
+
+// rename returns the name to use for an identifier in the current expansion
+// a parameter can be used as a name if its argument is a variable
+func (m *MacroExpander) rename(name Token) Token {
+	if argument, ok := m.bindings[name.lexeme]; ok {
+		if expr, ok := argument.(*Expression); ok {
+			if v, ok := expr.expression.(*Variable); ok {
+				return v.name
+			}
+		}
+		fmt.Println(NewParseError(name, "argument for '"+name.lexeme+"' must be a variable to be used as a name"))
+		return name
+	}
+	if renamed, ok := m.renames[name.lexeme]; ok {
+		name.lexeme = renamed
+	}
+	return name
+}
+
+func (m *MacroExpander) relabel(label Token) Token {
+	if renamed, ok := m.labels[label.lexeme]; ok {
+		label.lexeme = renamed
+	}
+	return label
+}
+
+func (m *MacroExpander) visitMacroStmt(stmt *Macro) interface{} {
+	fmt.Println(NewParseError(stmt.name, "macros can only be declared at top-level"))
+	return &Block{[]Stmt{}}
+}
+
+func (m *MacroExpander) visitMacroCallExpr(call *MacroCall) interface{} {
+	body := m.expand(call)
+	if body == nil {
+		return &Literal{nil}
+	}
+	if len(body) == 1 {
+		if stmt, ok := body[0].(*Expression); ok {
+			return stmt.expression
+		}
+	}
+	fmt.Println(NewParseError(call.name, "macro '"+call.name.lexeme+"' doesn't expand to an expression"))
+	return &Literal{nil}
+}
+
+// visitExpressionStmt expands macro calls and block arguments used as statements
+func (m *MacroExpander) visitExpressionStmt(stmt *Expression) interface{} {
+	switch expr := stmt.expression.(type) {
+	case *MacroCall:
+		return &Block{m.expand(expr)}
+	case *Variable:
+		if argument, ok := m.bindings[expr.name.lexeme]; ok {
+			return m.fragment(argument)
+		}
+	}
+	return &Expression{m.expr(stmt.expression)}
+}
+
+func (m *MacroExpander) visitVariableExpr(v *Variable) interface{} {
+	argument, ok := m.bindings[v.name.lexeme]
+	if !ok {
+		return &Variable{name: m.rename(v.name)}
+	}
+	if stmt, ok := m.fragment(argument).(*Expression); ok {
+		return stmt.expression
+	}
+	fmt.Println(NewParseError(v.name, "block argument '"+v.name.lexeme+"' can't be used as an expression"))
+	return &Literal{nil}
+}
+
+// visitAssignExpr allows assigning to parameters whose arguments are variables or properties
+func (m *MacroExpander) visitAssignExpr(a *Assign) interface{} {
+	value := m.expr(a.value)
+
+	argument, ok := m.bindings[a.name.lexeme]
+	if !ok {
+		return &Assign{name: m.rename(a.name), value: value}
+	}
+	if stmt, ok := m.fragment(argument).(*Expression); ok {
+		switch target := stmt.expression.(type) {
+		case *Variable:
+			return &Assign{name: target.name, value: value}
+		case *Get:
+			return &Set{target.object, target.name, value}
+		}
+	}
+	fmt.Println(NewParseError(a.name, "invalid assignment target"))
+	return value
+}
+
+func (m *MacroExpander) visitAwaitExpr(a *Await) interface{} {
+	return &Await{a.keyword, m.expr(a.value)}
+}
+
+func (m *MacroExpander) visitBinaryExpr(b *Binary) interface{} {
+	return &Binary{m.expr(b.left), b.operator, m.expr(b.right)}
+}
+
+func (m *MacroExpander) visitCallExpr(c *Call) interface{} {
+	return &Call{m.expr(c.callee), c.paren, m.exprs(c.arguments)}
+}
+
+func (m *MacroExpander) visitGetExpr(g *Get) interface{} {
+	return &Get{m.expr(g.object), g.name}
+}
+
+func (m *MacroExpander) visitGroupingExpr(g *Grouping) interface{} {
+	return &Grouping{m.expr(g.expression)}
+}
+
+func (m *MacroExpander) visitLiteralExpr(l *Literal) interface{} {
+	return &Literal{l.value}
+}
+
+func (m *MacroExpander) visitLogicalExpr(l *Logical) interface{} {
+	return &Logical{m.expr(l.left), l.operator, m.expr(l.right)}
+}
+
+func (m *MacroExpander) visitSetExpr(s *Set) interface{} {
+	return &Set{m.expr(s.object), s.name, m.expr(s.value)}
+}
+
+func (m *MacroExpander) visitSliceExpr(s *Slice) interface{} {
+	return &Slice{m.expr(s.object), s.bracket, m.expr(s.start), m.expr(s.stop), m.expr(s.step)}
+}
+
+func (m *MacroExpander) visitSuperExpr(s *Super) interface{} {
+	return &Super{keyword: s.keyword, method: s.method}
+}
+
+func (m *MacroExpander) visitThisExpr(t *This) interface{} {
+	return &This{keyword: t.keyword}
+}
+
+func (m *MacroExpander) visitUnaryExpr(u *Unary) interface{} {
+	return &Unary{u.operator, m.expr(u.right)}
+}
+
+func (m *MacroExpander) visitBlockStmt(stmt *Block) interface{} {
+	return &Block{m.stmts(stmt.statements)}
+}
+
+func (m *MacroExpander) visitClassStmt(stmt *Class) interface{} {
+	superclass := stmt.superclass
+	if superclass != (Variable{}) {
+		superclass = Variable{name: m.rename(superclass.name)}
+	}
+
+	fields := make([]Var, len(stmt.fields))
+	for i, field := range stmt.fields {
+		fields[i] = Var{field.name, m.rename(field.annotation), m.expr(field.initializer)}
+	}
+
+	return &Class{
+		m.rename(stmt.name),
+		superclass,
+		m.methods(stmt.methods),
+		m.methods(stmt.getters),
+		m.methods(stmt.setters),
+		fields,
+		m.variables(stmt.traits),
+		m.variables(stmt.interfaces),
+		m.methods(stmt.abstracts),
+		m.exprs(stmt.decorators),
+	}
+}
+
+func (m *MacroExpander) visitTraitStmt(stmt *Trait) interface{} {
+	return &Trait{m.rename(stmt.name), m.methods(stmt.methods)}
+}
+
+func (m *MacroExpander) visitInterfaceStmt(stmt *Interface) interface{} {
+	return &Interface{m.rename(stmt.name), m.methods(stmt.methods)}
+}
+
+func (m *MacroExpander) visitEnumStmt(stmt *Enum) interface{} {
+	return &Enum{m.rename(stmt.name), append([]Token{}, stmt.members...)}
+}
+
+func (m *MacroExpander) visitRecordStmt(stmt *Record) interface{} {
+	return &Record{m.rename(stmt.name), append([]Token{}, stmt.fields...)}
+}
+
+func (m *MacroExpander) visitExtensionStmt(stmt *Extension) interface{} {
+	return &Extension{Variable{name: m.rename(stmt.target.name)}, m.methods(stmt.methods)}
+}
+
+func (m *MacroExpander) visitFunctionStmt(stmt *Function) interface{} {
+	function := m.function(*stmt)
+	function.name = m.rename(stmt.name)
+	return &function
+}
+
+func (m *MacroExpander) visitIfStmt(stmt *If) interface{} {
+	return &If{m.expr(stmt.condition), m.stmt(stmt.thenBranch), m.stmt(stmt.elseBranch)}
+}
+
+func (m *MacroExpander) visitWhileStmt(stmt *While) interface{} {
+	return &While{m.expr(stmt.condition), m.stmt(stmt.body), m.expr(stmt.increment), m.relabel(stmt.label)}
+}
+
+func (m *MacroExpander) visitForInStmt(stmt *ForIn) interface{} {
+	return &ForIn{stmt.keyword, m.rename(stmt.name), m.expr(stmt.iterable), m.stmt(stmt.body), m.relabel(stmt.label)}
+}
+
+func (m *MacroExpander) visitPrintStmt(stmt *Print) interface{} {
+	return &Print{m.expr(stmt.expression)}
+}
+
+func (m *MacroExpander) visitReturnStmt(stmt *Return) interface{} {
+	return &Return{stmt.keyword, m.expr(stmt.value)}
+}
+
+func (m *MacroExpander) visitBreakStmt(stmt *Break) interface{} {
+	return &Break{stmt.keyword, m.relabel(stmt.label)}
+}
+
+func (m *MacroExpander) visitContinueStmt(stmt *Continue) interface{} {
+	return &Continue{stmt.keyword, m.relabel(stmt.label)}
+}
+
+func (m *MacroExpander) visitDeferStmt(stmt *Defer) interface{} {
+	return &Defer{stmt.keyword, m.call(stmt.keyword, stmt.call)}
+}
+
+func (m *MacroExpander) visitSpawnStmt(stmt *Spawn) interface{} {
+	return &Spawn{stmt.keyword, m.call(stmt.keyword, stmt.call)}
+}
+
+func (m *MacroExpander) visitSelectStmt(stmt *Select) interface{} {
+	cases := make([]SelectCase, len(stmt.cases))
+	for i, c := range stmt.cases {
+		cases[i] = SelectCase{c.operation, m.rename(c.name), m.expr(c.channel), m.expr(c.value), m.stmts(c.body)}
+	}
+	return &Select{stmt.keyword, cases, m.stmt(stmt.fallback)}
+}
+
+func (m *MacroExpander) visitAssertStmt(stmt *Assert) interface{} {
+	return &Assert{stmt.keyword, m.expr(stmt.condition), m.expr(stmt.message), stmt.source}
+}
+
+func (m *MacroExpander) visitTestStmt(stmt *Test) interface{} {
+	return &Test{stmt.keyword, stmt.name, m.stmts(stmt.body)}
+}
+
+func (m *MacroExpander) visitVarStmt(stmt *Var) interface{} {
+	return &Var{m.rename(stmt.name), m.rename(stmt.annotation), m.expr(stmt.initializer)}
+}
+
+// function copies a function, the caller decides how to rename it
+func (m *MacroExpander) function(f Function) Function {
+	params := make([]Token, len(f.params))
+	for i, param := range f.params {
+		params[i] = m.rename(param)
+	}
+	paramTypes := make([]Token, len(f.paramTypes))
+	for i, paramType := range f.paramTypes {
+		paramTypes[i] = m.rename(paramType)
+	}
+	return Function{f.name, params, paramTypes, m.rename(f.returnType), m.stmts(f.body), m.exprs(f.decorators), f.async}
+}
+
+// methods copies methods keeping their names since they're looked up as properties
+func (m *MacroExpander) methods(methods []Function) []Function {
+	copied := make([]Function, len(methods))
+	for i, method := range methods {
+		copied[i] = m.function(method)
+	}
+	return copied
+}
+
+func (m *MacroExpander) variables(variables []Variable) []Variable {
+	copied := make([]Variable, len(variables))
+	for i, v := range variables {
+		copied[i] = Variable{name: m.rename(v.name)}
+	}
+	return copied
+}
+
+// call copies the call of a defer or spawn statement, which must stay a call
+func (m *MacroExpander) call(keyword Token, c *Call) *Call {
+	if call, ok := m.expr(c).(*Call); ok {
+		return call
+	}
+	fmt.Println(NewParseError(keyword, "expect function call after '"+keyword.lexeme+"'"))
+	return c
+}
+
+func (m *MacroExpander) stmts(statements []Stmt) []Stmt {
+	copied := make([]Stmt, len(statements))
+	for i, stmt := range statements {
+		copied[i] = m.stmt(stmt)
+	}
+	return copied
+}
+
+func (m *MacroExpander) stmt(stmt Stmt) Stmt {
+	if stmt == nil {
+		return nil
+	}
+	return stmt.accept(m).(Stmt)
+}
+
+func (m *MacroExpander) exprs(exprs []Expr) []Expr {
+	copied := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		copied[i] = m.expr(expr)
+	}
+	return copied
+}
+
+func (m *MacroExpander) expr(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return expr.accept(m).(Expr)
+}
+
+// declaredNames collects the names of variables, functions, parameters and types
+// declared in a macro body, property and method names aren't included
+func declaredNames(statements []Stmt, names []string) []string {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *Var:
+			names = append(names, s.name.lexeme)
+		case *Function:
+			names = append(names, s.name.lexeme)
+			names = functionNames(*s, names)
+		case *Class:
+			names = append(names, s.name.lexeme)
+			for _, group := range [][]Function{s.methods, s.getters, s.setters, s.abstracts} {
+				for _, method := range group {
+					names = functionNames(method, names)
+				}
+			}
+		case *Trait:
+			names = append(names, s.name.lexeme)
+			for _, method := range s.methods {
+				names = functionNames(method, names)
+			}
+		case *Interface:
+			names = append(names, s.name.lexeme)
+		case *Enum:
+			names = append(names, s.name.lexeme)
+		case *Record:
+			names = append(names, s.name.lexeme)
+		case *Extension:
+			for _, method := range s.methods {
+				names = functionNames(method, names)
+			}
+		case *Block:
+			names = declaredNames(s.statements, names)
+		case *If:
+			names = declaredNames([]Stmt{s.thenBranch, s.elseBranch}, names)
+		case *While:
+			names = declaredNames([]Stmt{s.body}, names)
+		case *ForIn:
+			names = append(names, s.name.lexeme)
+			names = declaredNames([]Stmt{s.body}, names)
+		case *Select:
+			for _, c := range s.cases {
+				if c.name != (Token{}) {
+					names = append(names, c.name.lexeme)
+				}
+				names = declaredNames(c.body, names)
+			}
+			names = declaredNames([]Stmt{s.fallback}, names)
+		}
+	}
+	return names
+}
+
+func functionNames(f Function, names []string) []string {
+	for _, param := range f.params {
+		names = append(names, param.lexeme)
+	}
+	return declaredNames(f.body, names)
+}
+
+// declaredLabels collects the labels of loops in a macro body
+func declaredLabels(statements []Stmt, labels []string) []string {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *While:
+			if s.label != (Token{}) {
+				labels = append(labels, s.label.lexeme)
+			}
+			labels = declaredLabels([]Stmt{s.body}, labels)
+		case *ForIn:
+			if s.label != (Token{}) {
+				labels = append(labels, s.label.lexeme)
+			}
+			labels = declaredLabels([]Stmt{s.body}, labels)
+		case *Block:
+			labels = declaredLabels(s.statements, labels)
+		case *If:
+			labels = declaredLabels([]Stmt{s.thenBranch, s.elseBranch}, labels)
+		case *Select:
+			for _, c := range s.cases {
+				labels = declaredLabels(c.body, labels)
+			}
+			labels = declaredLabels([]Stmt{s.fallback}, labels)
+		}
+	}
+	return labels
+}
@@ -2,27 +2,48 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 )
 
+// Config holds the options set through command line flags
+type Config struct {
+	optionalSemicolons bool
+	virtualClock       bool
+	expandMacros       bool
+	test               bool
+	vm                 bool
+}
+
 func main() {
-	args := os.Args[1:]
-	path := os.Args[0]
+	var config Config
+	flag.BoolVar(&config.optionalSemicolons, "optional-semicolons", false, "end statements at line breaks, same as the "+optionalSemicolonsPragma+" pragma")
+	flag.BoolVar(&config.virtualClock, "virtual-clock", false, "run timers without waiting, for testing programs using timers")
+	flag.BoolVar(&config.expandMacros, "expand-macros", false, "print the AST after expanding macros instead of running the program")
+	flag.BoolVar(&config.test, "test", false, "run the test blocks of the file after the rest of it and report the results")
+	flag.BoolVar(&config.vm, "vm", false, "compile the program to bytecode and run it on a stack VM instead of walking the AST")
+	flag.Usage = func() {
+		fmt.Println("Usage:", os.Args[0], "[flags] [file-name]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
 	switch len(args) {
 	case 0:
-		runPrompt()
+		runPrompt(config)
 	case 1:
-		runFile(args[0])
+		runFile(args[0], config)
 	default:
-		fmt.Println("Usage:", path, "<file-name>")
+		flag.Usage()
 		os.Exit(64)
 	}
 }
 
-func runFile(path string) {
-	s := NewSession(false)
+func runFile(path string, config Config) {
+	s := NewSession(false, config)
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		fmt.Println(err)
@@ -32,13 +53,16 @@ func runFile(path string) {
 	if hadError {
 		os.Exit(65)
 	}
-	if hadRuntimeError {
+	if hadTestFailure {
+		os.Exit(1)
+	}
+	if hadRuntimeError.get() {
 		os.Exit(70)
 	}
 }
 
-func runPrompt() {
-	s := NewSession(true)
+func runPrompt(config Config) {
+	s := NewSession(true, config)
 	reader := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print("> ")
@@ -48,18 +72,32 @@ func runPrompt() {
 		}
 		run(string(line), s)
 		hadError = false
-		hadRuntimeError = false
+		hadRuntimeError.set(false)
 	}
 }
 
 func run(source string, s Session) {
-	tokens := NewScanner(source).ScanTokens()
-	statements := NewParser(tokens).Parse()
+	scanner := NewScanner(source)
+	tokens := scanner.ScanTokens()
+	optionalSemicolons := s.config.optionalSemicolons || scanner.optionalSemicolons
+	statements := NewParser(tokens, optionalSemicolons).Parse()
+
+	if hadError {
+		return
+	}
+
+	statements = s.macros.Expand(statements)
 
 	if hadError {
 		return
 	}
 
+	if s.config.expandMacros {
+		a := AstPrinter{}
+		a.Print(statements)
+		return
+	}
+
 	if s.debugAst {
 		a := AstPrinter{}
 		a.Print(statements)
@@ -67,25 +105,62 @@ func run(source string, s Session) {
 
 	s.resolver.resolve(statements)
 
-	if hadError || hadRuntimeError {
+	if hadError || hadRuntimeError.get() {
 		return
 	}
 
-	s.interpreter.Interpret(statements)
+	s.typeChecker.check(statements)
+
+	if hadError {
+		return
+	}
+
+	s.backend.Interpret(statements)
+
+	if s.config.test && !hadError && !hadRuntimeError.get() {
+		if _, failed := s.backend.RunTests(statements); failed > 0 {
+			hadTestFailure = true
+		}
+	}
+}
+
+// Backend runs resolved programs, either the Interpreter or the VM
+type Backend interface {
+	Interpret(statements []Stmt)
+	RunTests(statements []Stmt) (passed int, failed int)
 }
 
 type Session struct {
 	interpreter *Interpreter
+	backend     Backend
 	resolver    *Resolver
+	typeChecker *TypeChecker
+	macros      *MacroExpander
 	debugAst    bool
+	config      Config
 }
 
-func NewSession(replMode bool) Session {
-	in := NewInterpreter(replMode)
+func NewSession(replMode bool, config Config) Session {
+	var clock Clock = NewRealClock()
+	if config.virtualClock {
+		clock = &VirtualClock{}
+	}
+	in := NewInterpreter(replMode, NewEventLoop(clock))
+	// the VM shares the globals the Resolver indexes with the Interpreter
+	var backend Backend = in
+	if config.vm {
+		backend = NewVM(in)
+	}
+
+	resolver := NewResolver(in)
 
 	return Session{
 		interpreter: in,
-		resolver:    NewResolver(in),
+		backend:     backend,
+		resolver:    resolver,
+		typeChecker: NewTypeChecker(resolver),
+		macros:      NewMacroExpander(),
 		debugAst:    false,
+		config:      config,
 	}
 }
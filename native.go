@@ -0,0 +1,24 @@
+package main
+
+// NativeFunction implements LoxCallable for functions written in Go
+type NativeFunction struct {
+	name     string
+	argCount int
+	function func(interpreter *Interpreter, args []interface{}) (interface{}, error)
+}
+
+func NewNativeFunction(name string, arity int, function func(*Interpreter, []interface{}) (interface{}, error)) *NativeFunction {
+	return &NativeFunction{name, arity, function}
+}
+
+func (n *NativeFunction) arity() int {
+	return n.argCount
+}
+
+func (n *NativeFunction) call(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	return n.function(interpreter, args)
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn>"
+}
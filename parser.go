@@ -1,16 +1,21 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Parser implements ExprVisitor, StmtVisitor
 // Uses recursive descent parsing
 type Parser struct {
 	tokens  []Token
 	current int
+	// line breaks can end statements in place of ';'
+	optionalSemicolons bool
 }
 
-func NewParser(tokens []Token) *Parser {
-	return &Parser{tokens, 0}
+func NewParser(tokens []Token, optionalSemicolons bool) *Parser {
+	return &Parser{tokens, 0, optionalSemicolons}
 }
 
 func (p *Parser) Parse() []Stmt {
@@ -34,16 +39,73 @@ func (p *Parser) declaration() Stmt {
 	}()
 
 	switch true {
+	case p.check(AT):
+		return p.decoratedDeclaration()
 	case p.match(CLASS):
 		return p.classDeclaration()
+	case p.match(TRAIT):
+		return p.traitDeclaration()
+	case p.match(INTERFACE):
+		return p.interfaceDeclaration()
+	case p.match(ENUM):
+		return p.enumDeclaration()
+	case p.match(RECORD):
+		return p.recordDeclaration()
+	case p.match(EXTEND):
+		return p.extensionDeclaration()
+	case p.match(MACRO):
+		return p.macroDeclaration()
+	case p.match(TEST):
+		return p.testDeclaration()
 	case p.match(FUN):
 		return p.function("function")
+	case p.match(ASYNC):
+		return p.asyncFunction()
 	case p.match(VAR):
 		return p.varDeclaration()
 	}
 	return p.statement()
 }
 
+// decoratedDeclaration parses a function or class preceded by decorators
+func (p *Parser) decoratedDeclaration() Stmt {
+	decorators := p.decorators()
+
+	switch {
+	case p.match(FUN):
+		function := p.function("function").(*Function)
+		function.decorators = decorators
+		return function
+	case p.match(ASYNC):
+		function := p.asyncFunction()
+		function.decorators = decorators
+		return function
+	case p.match(CLASS):
+		class := p.classDeclaration().(*Class)
+		class.decorators = decorators
+		return class
+	}
+
+	panic(NewParseError(p.peek(), "expect function or class after decorators"))
+}
+
+// asyncFunction parses "async fun name() { ... }", calling it returns a promise
+func (p *Parser) asyncFunction() *Function {
+	p.consume(FUN, "expect 'fun' after 'async'")
+	function := p.function("function").(*Function)
+	function.async = true
+	return function
+}
+
+// decorators parses zero or more "@expression" before a declaration
+func (p *Parser) decorators() []Expr {
+	decorators := []Expr{}
+	for p.match(AT) {
+		decorators = append(decorators, p.call())
+	}
+	return decorators
+}
+
 func (p *Parser) classDeclaration() Stmt {
 	name := p.consume(IDENTIFIER, "expect class name")
 
@@ -51,29 +113,324 @@ func (p *Parser) classDeclaration() Stmt {
 
 	if p.match(LESS) {
 		p.consume(IDENTIFIER, "expect superclass name")
-		superclass = Variable{p.previous()}
+		superclass = Variable{name: p.previous()}
+	}
+
+	traits := []Variable{}
+
+	if p.match(WITH) {
+		traits = p.nameList("trait")
+	}
+
+	interfaces := []Variable{}
+
+	if p.match(IMPLEMENTS) {
+		interfaces = p.nameList("interface")
 	}
 
 	p.consume(LEFT_BRACE, "expect '{' before class body")
 
 	methods := []Function{}
+	getters := []Function{}
+	setters := []Function{}
+	fields := []Var{}
+	abstracts := []Function{}
 
 	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
-		methods = append(methods, *p.function("method").(*Function))
+		decorators := p.decorators()
+		decorated := len(decorators) > 0
+
+		switch {
+		case p.match(VAR):
+			field := p.fieldDeclaration()
+			if decorated {
+				fmt.Println(NewParseError(field.name, "only methods can be decorated"))
+			}
+			fields = append(fields, *field)
+		case p.check(IDENTIFIER) && p.peek().lexeme == "set" && (p.checkNext(IDENTIFIER) || p.checkNext(PRIVATE_NAME)):
+			// "set" is only treated as a keyword when followed by a name
+			p.advance()
+			setter := p.setter()
+			if decorated {
+				fmt.Println(NewParseError(setter.name, "only methods can be decorated"))
+			}
+			setters = append(setters, *setter)
+		case (p.check(IDENTIFIER) || p.check(PRIVATE_NAME)) && (p.checkNext(LEFT_BRACE) || p.checkNext(COLON)):
+			getter := p.getter()
+			if decorated {
+				fmt.Println(NewParseError(getter.name, "only methods can be decorated"))
+			}
+			getters = append(getters, *getter)
+		default:
+			async := p.match(ASYNC)
+			// methods declared without a body are abstract
+			method := p.signature("method")
+			method.async = async
+			if !p.check(LEFT_BRACE) && p.endsStatement() {
+				if decorated {
+					fmt.Println(NewParseError(method.name, "abstract methods can't be decorated"))
+				}
+				if async {
+					fmt.Println(NewParseError(method.name, "abstract methods can't be async"))
+				}
+				abstracts = append(abstracts, *method)
+			} else {
+				p.consume(LEFT_BRACE, "expect '{' before method body")
+				method.body = p.block()
+				method.decorators = decorators
+				methods = append(methods, *method)
+			}
+		}
 	}
 
 	p.consume(RIGHT_BRACE, "expect '}' after class body")
 
-	return &Class{name, superclass, methods}
+	return &Class{name, superclass, methods, getters, setters, fields, traits, interfaces, abstracts, nil}
+}
+
+// nameList parses one or more comma separated names
+func (p *Parser) nameList(kind string) []Variable {
+	names := []Variable{}
+	for {
+		p.consume(IDENTIFIER, "expect "+kind+" name")
+		names = append(names, Variable{name: p.previous()})
+		if !p.match(COMMA) {
+			break
+		}
+	}
+	return names
+}
+
+func (p *Parser) enumDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect enum name")
+
+	p.consume(LEFT_BRACE, "expect '{' before enum body")
+
+	members := []Token{}
+
+	// allows a trailing comma after the last member
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		members = append(members, p.consume(IDENTIFIER, "expect enum member name"))
+		if !p.match(COMMA) {
+			break
+		}
+	}
+
+	p.consume(RIGHT_BRACE, "expect '}' after enum members")
+
+	return &Enum{name, members}
+}
+
+func (p *Parser) recordDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect record name")
+
+	p.consume(LEFT_PAREN, "expect '(' after record name")
+
+	fields := []Token{}
+
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(fields) >= 255 {
+				fmt.Println(NewParseError(p.peek(), "can't have more than 255 fields"))
+			}
+
+			fields = append(fields, p.consume(IDENTIFIER, "expect field name"))
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	p.consume(RIGHT_PAREN, "expect ')' after record fields")
+	p.terminator("expect ';' after record declaration")
+
+	return &Record{name, fields}
+}
+
+func (p *Parser) interfaceDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect interface name")
+
+	p.consume(LEFT_BRACE, "expect '{' before interface body")
+
+	methods := []Function{}
+
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, *p.signature("method"))
+		p.terminator("expect ';' after method signature")
+	}
+
+	p.consume(RIGHT_BRACE, "expect '}' after interface body")
+
+	return &Interface{name, methods}
 }
 
-// @param kind: "function", "method"
+func (p *Parser) traitDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect trait name")
+
+	p.consume(LEFT_BRACE, "expect '{' before trait body")
+
+	methods := []Function{}
+
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, *p.function("method").(*Function))
+	}
+
+	p.consume(RIGHT_BRACE, "expect '}' after trait body")
+
+	return &Trait{name, methods}
+}
+
+// extensionDeclaration parses "extend String { ... }", adding methods
+// to a builtin type or to a class declared earlier
+func (p *Parser) extensionDeclaration() Stmt {
+	p.consume(IDENTIFIER, "expect type or class name after 'extend'")
+	target := Variable{name: p.previous()}
+
+	p.consume(LEFT_BRACE, "expect '{' before extension body")
+
+	methods := []Function{}
+
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, *p.function("method").(*Function))
+	}
+
+	p.consume(RIGHT_BRACE, "expect '}' after extension body")
+
+	return &Extension{target, methods}
+}
+
+// testDeclaration parses "test "name" { ... }", the block only runs in test mode
+func (p *Parser) testDeclaration() Stmt {
+	keyword := p.previous()
+	name := p.consume(STRING, "expect test name")
+	p.consume(LEFT_BRACE, "expect '{' before test body")
+	return &Test{keyword, name, p.block()}
+}
+
+// macroDeclaration parses "macro name(params) { ... }", the body is a
+// template which is copied for each call with the parameters replaced
+func (p *Parser) macroDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "expect macro name")
+
+	p.consume(LEFT_PAREN, "expect '(' after macro name")
+
+	params := []Token{}
+
+	if !p.check(RIGHT_PAREN) {
+		for {
+			params = append(params, p.consume(IDENTIFIER, "expect parameter name"))
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	p.consume(RIGHT_PAREN, "expect ')' after parameters")
+	p.consume(LEFT_BRACE, "expect '{' before macro body")
+
+	return &Macro{name, params, p.block()}
+}
+
+// macroCall parses "name!(args)" where each argument is an expression or a block
+func (p *Parser) macroCall() Expr {
+	name := p.previous()
+	p.consume(BANG, "expect '!' after macro name")
+	p.consume(LEFT_PAREN, "expect '(' after '!'")
+
+	arguments := []Stmt{}
+
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if p.match(LEFT_BRACE) {
+				arguments = append(arguments, &Block{p.block()})
+			} else {
+				arguments = append(arguments, &Expression{p.expression()})
+			}
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	p.consume(RIGHT_PAREN, "expect ')' after macro arguments")
+
+	return &MacroCall{name, arguments}
+}
+
+// memberName consumes the name of a class member which may be private
+func (p *Parser) memberName(kind string) Token {
+	if p.match(PRIVATE_NAME) {
+		return p.previous()
+	}
+	return p.consume(IDENTIFIER, "expect "+kind+" name")
+}
+
+// propertyName consumes the name after '.', keywords are allowed as property names
+func (p *Parser) propertyName() Token {
+	if _, ok := keywords[p.peek().lexeme]; ok {
+		name := p.advance()
+		name.typ = IDENTIFIER
+		return name
+	}
+	return p.memberName("property")
+}
+
+// fieldDeclaration parses "var name = value;" inside a class body
+func (p *Parser) fieldDeclaration() *Var {
+	name := p.memberName("field")
+	annotation := p.typeAnnotation()
+	var initializer Expr
+
+	if p.match(EQUAL) {
+		initializer = p.expression()
+	}
+
+	p.terminator("expect ';' after field declaration")
+	return &Var{name, annotation, initializer}
+}
+
+// getter parses a method declared without a parameter list
+func (p *Parser) getter() *Function {
+	name := p.memberName("getter")
+	returnType := p.typeAnnotation()
+	p.consume(LEFT_BRACE, "expect '{' before getter body")
+	body := p.block()
+	return &Function{name, nil, nil, returnType, body, nil, false}
+}
+
+// setter parses a method declared as "set name(value) { ... }"
+func (p *Parser) setter() *Function {
+	function := p.function("setter").(*Function)
+	if len(function.params) != 1 {
+		fmt.Println(NewParseError(function.name, "setter must have exactly one parameter"))
+	}
+	return function
+}
+
+// @param kind: "function", "method", "setter"
 func (p *Parser) function(kind string) Stmt {
-	name := p.consume(IDENTIFIER, "expect "+kind+" name")
+	function := p.signature(kind)
+
+	p.consume(LEFT_BRACE, "expect '{' before "+kind+" body")
+
+	function.body = p.block()
+
+	return function
+}
+
+// signature parses the name and parameters of a function without its body
+func (p *Parser) signature(kind string) *Function {
+	var name Token
+	if kind == "function" {
+		name = p.consume(IDENTIFIER, "expect "+kind+" name")
+	} else {
+		name = p.memberName(kind)
+	}
 
 	p.consume(LEFT_PAREN, "expect '(' after "+kind+" name")
 
 	var parameters []Token
+	var paramTypes []Token
 
 	if !p.check(RIGHT_PAREN) {
 		for {
@@ -82,6 +439,7 @@ func (p *Parser) function(kind string) Stmt {
 			}
 
 			parameters = append(parameters, p.consume(IDENTIFIER, "expect parameter name"))
+			paramTypes = append(paramTypes, p.typeAnnotation())
 			if !p.match(COMMA) {
 				break
 			}
@@ -89,24 +447,31 @@ func (p *Parser) function(kind string) Stmt {
 	}
 
 	p.consume(RIGHT_PAREN, "expect ')' after parameters")
+	returnType := p.typeAnnotation()
 
-	p.consume(LEFT_BRACE, "expect '{' before "+kind+" body")
-
-	body := p.block()
-
-	return &Function{name, parameters, body}
+	return &Function{name, parameters, paramTypes, returnType, nil, nil, false}
 }
 
 func (p *Parser) varDeclaration() Stmt {
 	name := p.consume(IDENTIFIER, "expect variable name")
+	annotation := p.typeAnnotation()
 	var initializer Expr
 
 	if p.match(EQUAL) {
 		initializer = p.expression()
 	}
 
-	p.consume(SEMICOLON, "expect ';' after variable declaration")
-	return &Var{name, initializer}
+	p.terminator("expect ';' after variable declaration")
+	return &Var{name, annotation, initializer}
+}
+
+// typeAnnotation parses an optional ": Type" after a name or parameter list,
+// an empty token is returned for unannotated declarations
+func (p *Parser) typeAnnotation() Token {
+	if p.match(COLON) {
+		return p.consume(IDENTIFIER, "expect type name after ':'")
+	}
+	return Token{}
 }
 
 func (p *Parser) statement() Stmt {
@@ -117,12 +482,24 @@ func (p *Parser) statement() Stmt {
 		return p.returnStatement()
 	case p.match(BREAK):
 		return p.breakStatement()
+	case p.match(CONTINUE):
+		return p.continueStatement()
+	case p.match(DEFER):
+		return p.deferStatement()
+	case p.match(ASSERT):
+		return p.assertStatement()
+	case p.match(SPAWN):
+		return p.spawnStatement()
+	case p.match(SELECT):
+		return p.selectStatement()
 	case p.match(IF):
 		return p.ifStatement()
 	case p.match(FOR):
-		return p.forStatement()
+		return p.forStatement(Token{})
 	case p.match(WHILE):
-		return p.whileStatement()
+		return p.whileStatement(Token{})
+	case p.check(IDENTIFIER) && p.checkNext(COLON):
+		return p.labeledStatement()
 	case p.match(LEFT_BRACE):
 		return &Block{p.block()}
 	}
@@ -142,27 +519,156 @@ func (p *Parser) block() []Stmt {
 
 func (p *Parser) printStatement() Stmt {
 	value := p.expression()
-	p.consume(SEMICOLON, "expect ';' after value")
+	p.terminator("expect ';' after value")
 	return &Print{value}
 }
 
 func (p *Parser) returnStatement() Stmt {
 	keyword := p.previous()
 
+	// in optional semicolon mode a value must start on the same line as return
 	var value Expr
-	if !p.check(SEMICOLON) {
+	if !p.check(SEMICOLON) && !p.lineEnds() {
 		value = p.expression()
 	}
 
-	p.consume(SEMICOLON, "expect ';' after return value")
+	p.terminator("expect ';' after return value")
 	return &Return{keyword, value}
 }
 
+// labeledStatement parses a loop preceded by "label:"
+func (p *Parser) labeledStatement() Stmt {
+	label := p.advance()
+	p.consume(COLON, "expect ':' after label")
+
+	switch {
+	case p.match(FOR):
+		return p.forStatement(label)
+	case p.match(WHILE):
+		return p.whileStatement(label)
+	}
+
+	panic(NewParseError(p.peek(), "expect loop after label"))
+}
+
 func (p *Parser) breakStatement() Stmt {
 	keyword := p.previous()
 
-	p.consume(SEMICOLON, "expect ';' after break statement")
-	return &Break{keyword}
+	var label Token
+	if !p.lineEnds() && p.match(IDENTIFIER) {
+		label = p.previous()
+	}
+
+	p.terminator("expect ';' after break statement")
+	return &Break{keyword, label}
+}
+
+func (p *Parser) continueStatement() Stmt {
+	keyword := p.previous()
+
+	var label Token
+	if !p.lineEnds() && p.match(IDENTIFIER) {
+		label = p.previous()
+	}
+
+	p.terminator("expect ';' after continue statement")
+	return &Continue{keyword, label}
+}
+
+// assertStatement keeps the source of the condition for the error message
+func (p *Parser) assertStatement() Stmt {
+	keyword := p.previous()
+
+	start := p.current
+	condition := p.expression()
+	source := sourceText(p.tokens[start:p.current])
+
+	var message Expr
+	if p.match(COMMA) {
+		message = p.expression()
+	}
+
+	p.terminator("expect ';' after assertion")
+	return &Assert{keyword, condition, message, source}
+}
+
+func (p *Parser) deferStatement() Stmt {
+	keyword := p.previous()
+
+	call, ok := p.expression().(*Call)
+	if !ok {
+		panic(NewParseError(keyword, "expression in defer must be a function call"))
+	}
+
+	p.terminator("expect ';' after deferred call")
+	return &Defer{keyword, call}
+}
+
+func (p *Parser) spawnStatement() Stmt {
+	keyword := p.previous()
+
+	call, ok := p.expression().(*Call)
+	if !ok {
+		panic(NewParseError(keyword, "expression in spawn must be a function call"))
+	}
+
+	p.terminator("expect ';' after spawned call")
+	return &Spawn{keyword, call}
+}
+
+// selectStatement parses cases of the form "var v = recv(ch) { ... }",
+// "recv(ch) { ... }" and "send(ch, value) { ... }" with an optional "else { ... }"
+func (p *Parser) selectStatement() Stmt {
+	keyword := p.previous()
+
+	p.consume(LEFT_BRACE, "expect '{' after 'select'")
+
+	cases := []SelectCase{}
+	var fallback Stmt
+
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		if p.match(ELSE) {
+			if fallback != nil {
+				panic(NewParseError(p.previous(), "select can only have one else case"))
+			}
+			p.consume(LEFT_BRACE, "expect '{' after 'else'")
+			fallback = &Block{p.block()}
+			continue
+		}
+
+		var name Token
+		if p.match(VAR) {
+			name = p.consume(IDENTIFIER, "expect variable name")
+			p.consume(EQUAL, "expect '=' after variable name")
+		}
+
+		// "recv" and "send" are only treated as keywords inside select
+		operation := p.consume(IDENTIFIER, "expect 'recv' or 'send' in select case")
+		if operation.lexeme != "recv" && operation.lexeme != "send" {
+			panic(NewParseError(operation, "expect 'recv' or 'send' in select case"))
+		}
+
+		p.consume(LEFT_PAREN, "expect '(' after '"+operation.lexeme+"'")
+		channel := p.expression()
+
+		var value Expr
+		if operation.lexeme == "send" {
+			if name != (Token{}) {
+				panic(NewParseError(operation, "can't assign the result of send"))
+			}
+			p.consume(COMMA, "expect ',' after channel")
+			value = p.expression()
+		}
+
+		p.consume(RIGHT_PAREN, "expect ')' after select case")
+		p.consume(LEFT_BRACE, "expect '{' before case body")
+
+		cases = append(cases, SelectCase{operation, name, channel, value, p.block()})
+	}
+
+	p.consume(RIGHT_BRACE, "expect '}' after select cases")
+
+	return &Select{keyword, cases, fallback}
 }
 
 func (p *Parser) ifStatement() Stmt {
@@ -180,9 +686,21 @@ func (p *Parser) ifStatement() Stmt {
 	return &If{condition, thenBranch, elseBranch}
 }
 
-func (p *Parser) forStatement() Stmt {
+// @param label: zero value for loops without a label
+func (p *Parser) forStatement(label Token) Stmt {
+	keyword := p.previous()
 	p.consume(LEFT_PAREN, "expect '(' after 'for'")
 
+	// for (var name in iterable) body
+	start := p.current
+	if p.match(VAR) && p.match(IDENTIFIER) && p.match(IN) {
+		name := p.tokens[start+1]
+		iterable := p.expression()
+		p.consume(RIGHT_PAREN, "expect ')' after for-in clause")
+		return &ForIn{keyword, name, iterable, p.statement(), label}
+	}
+	p.current = start
+
 	initializer := (Stmt)(nil)
 	if p.match(SEMICOLON) {
 		initializer = nil
@@ -208,15 +726,12 @@ func (p *Parser) forStatement() Stmt {
 
 	body := p.statement()
 
-	if increment != nil {
-		body = &Block{[]Stmt{body, &Expression{increment}}}
-	}
-
 	if condition == nil {
 		condition = &Literal{true}
 	}
 
-	body = &While{condition, body}
+	// the increment is kept apart from the body so that continue doesn't skip it
+	body = &While{condition, body, increment, label}
 
 	if initializer != nil {
 		body = &Block{[]Stmt{initializer, body}}
@@ -225,19 +740,20 @@ func (p *Parser) forStatement() Stmt {
 	return body
 }
 
-func (p *Parser) whileStatement() Stmt {
+// @param label: zero value for loops without a label
+func (p *Parser) whileStatement(label Token) Stmt {
 	p.consume(LEFT_PAREN, "expect '(' after 'while'")
 	condition := p.expression()
 	p.consume(RIGHT_PAREN, "expect ')' after condition")
 
 	body := p.statement()
 
-	return &While{condition, body}
+	return &While{condition, body, nil, label}
 }
 
 func (p *Parser) expressionStatement() Stmt {
 	expr := p.expression()
-	p.consume(SEMICOLON, "expect ';' after expression")
+	p.terminator("expect ';' after expression")
 	return &Expression{expr}
 }
 
@@ -248,13 +764,13 @@ func (p *Parser) expression() Expr {
 func (p *Parser) assignment() Expr {
 	expr := p.or()
 
-	if p.match(EQUAL) {
+	if !p.lineEnds() && p.match(EQUAL) {
 		equals := p.previous()
 		value := p.assignment()
 
 		if e, ok := (expr).(*Variable); ok {
 			name := e.name
-			return &Assign{name, value}
+			return &Assign{name: name, value: value}
 		} else if e, ok := (expr).(*Get); ok {
 			return &Set{e.object, e.name, value}
 		}
@@ -268,7 +784,7 @@ func (p *Parser) assignment() Expr {
 func (p *Parser) or() Expr {
 	expr := p.and()
 
-	for p.match(OR) {
+	for !p.lineEnds() && p.match(OR) {
 		operator := p.previous()
 		right := p.and()
 		expr = &Logical{expr, operator, right}
@@ -280,7 +796,7 @@ func (p *Parser) or() Expr {
 func (p *Parser) and() Expr {
 	expr := p.equality()
 
-	for p.match(AND) {
+	for !p.lineEnds() && p.match(AND) {
 		operator := p.previous()
 		right := p.equality()
 		expr = &Logical{expr, operator, right}
@@ -292,7 +808,7 @@ func (p *Parser) and() Expr {
 func (p *Parser) equality() Expr {
 	expr := p.comparision()
 
-	for p.match(BANG_EQUAL, EQUAL_EQUAL) {
+	for !p.lineEnds() && p.match(BANG_EQUAL, EQUAL_EQUAL) {
 		operator := p.previous()
 		right := p.comparision()
 		expr = &Binary{expr, operator, right}
@@ -304,7 +820,7 @@ func (p *Parser) equality() Expr {
 func (p *Parser) comparision() Expr {
 	expr := p.term()
 
-	for p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL) {
+	for !p.lineEnds() && p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL, IS) {
 		operator := p.previous()
 		right := p.term()
 		expr = &Binary{expr, operator, right}
@@ -316,7 +832,7 @@ func (p *Parser) comparision() Expr {
 func (p *Parser) term() Expr {
 	expr := p.factor()
 
-	for p.match(MINUS, PLUS) {
+	for !p.lineEnds() && p.match(MINUS, PLUS) {
 		operator := p.previous()
 		right := p.factor()
 		expr = &Binary{expr, operator, right}
@@ -328,7 +844,7 @@ func (p *Parser) term() Expr {
 func (p *Parser) factor() Expr {
 	expr := p.unary()
 
-	for p.match(SLASH, STAR) {
+	for !p.lineEnds() && p.match(SLASH, STAR) {
 		operator := p.previous()
 		right := p.unary()
 		expr = &Binary{expr, operator, right}
@@ -344,6 +860,12 @@ func (p *Parser) unary() Expr {
 		return &Unary{operator, right}
 	}
 
+	if p.match(AWAIT) {
+		keyword := p.previous()
+		value := p.unary()
+		return &Await{keyword, value}
+	}
+
 	return p.call()
 }
 
@@ -351,11 +873,16 @@ func (p *Parser) call() Expr {
 	expr := p.primary()
 
 	for {
+		if p.lineEnds() {
+			break
+		}
 		if p.match(LEFT_PAREN) {
 			expr = p.finishCall(expr)
 		} else if p.match(DOT) {
-			name := p.consume(IDENTIFIER, "expect property name after '.'")
+			name := p.propertyName()
 			expr = &Get{expr, name}
+		} else if p.match(LEFT_BRACKET) {
+			expr = p.finishSlice(expr)
 		} else {
 			break
 		}
@@ -375,14 +902,22 @@ func (p *Parser) primary() Expr {
 	case p.match(NUMBER, STRING):
 		return &Literal{p.previous().literal}
 	case p.match(IDENTIFIER):
-		return &Variable{p.previous()}
+		if p.check(BANG) && p.checkNext(LEFT_PAREN) {
+			return p.macroCall()
+		}
+		return &Variable{name: p.previous()}
 	case p.match(THIS):
-		return &This{p.previous()}
+		return &This{keyword: p.previous()}
+	case p.match(PRIVATE_NAME):
+		panic(NewParseError(p.previous(), "private names can only be used as properties of 'this'"))
 	case p.match(SUPER):
 		keyword := p.previous()
 		p.consume(DOT, "expect '.' after 'super'")
+		if p.check(PRIVATE_NAME) {
+			panic(NewParseError(p.peek(), "private members can't be accessed through 'super'"))
+		}
 		method := p.consume(IDENTIFIER, "expect superclass method name")
-		return &Super{keyword, method}
+		return &Super{keyword: keyword, method: method}
 	case p.match(LEFT_PAREN):
 		expr := p.expression()
 		p.consume(RIGHT_PAREN, "expect ')' after expression.")
@@ -411,6 +946,14 @@ func (p *Parser) check(typ TokenType) bool {
 	return p.peek().typ == typ
 }
 
+// checkNext returns true if the token after the current one is of given type
+func (p *Parser) checkNext(typ TokenType) bool {
+	if p.isAtEnd() || p.tokens[p.current+1].typ == EOF {
+		return false
+	}
+	return p.tokens[p.current+1].typ == typ
+}
+
 // advance consumes and returns current token
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
@@ -442,6 +985,42 @@ func (p *Parser) consume(t TokenType, msg string) Token {
 	panic(NewParseError(p.peek(), msg))
 }
 
+// terminator consumes the ';' ending a statement
+func (p *Parser) terminator(msg string) {
+	if p.match(SEMICOLON) || p.lineEnds() {
+		return
+	}
+	panic(NewParseError(p.peek(), msg))
+}
+
+// endsStatement consumes a ';' or reports if a statement can end before the current token
+func (p *Parser) endsStatement() bool {
+	return p.match(SEMICOLON) || p.lineEnds()
+}
+
+// lineEnds returns true in optional semicolon mode if the current token
+// closes a block, is the end of file or is on a new line after a token
+// which can end a statement, like Go inserts semicolons
+func (p *Parser) lineEnds() bool {
+	if !p.optionalSemicolons {
+		return false
+	}
+	if p.isAtEnd() || p.check(RIGHT_BRACE) {
+		return true
+	}
+	return p.peek().line > p.previous().line && endsLine(p.previous().typ)
+}
+
+// endsLine returns true for the tokens after which a line break ends a statement
+func endsLine(typ TokenType) bool {
+	switch typ {
+	case IDENTIFIER, PRIVATE_NAME, NUMBER, STRING, TRUE, FALSE, NIL, THIS,
+		RIGHT_PAREN, RIGHT_BRACKET, RIGHT_BRACE, RETURN, BREAK, CONTINUE:
+		return true
+	}
+	return false
+}
+
 // synchronize discards token unless at a statement boundary
 // restores state on parsing errors
 func (p *Parser) synchronize() {
@@ -453,7 +1032,7 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().typ {
-		case CLASS, FUN, VAR, FOR, IF, WHILE, PRINT:
+		case CLASS, TRAIT, INTERFACE, ENUM, RECORD, EXTEND, MACRO, TEST, FUN, VAR, FOR, IF, WHILE, PRINT:
 			// discard tokens
 		case RETURN:
 			return
@@ -463,6 +1042,30 @@ func (p *Parser) synchronize() {
 	}
 }
 
+// finishSlice parses "[start:stop:step]" where each part can be left out
+func (p *Parser) finishSlice(object Expr) Expr {
+	bracket := p.previous()
+	var start, stop, step Expr
+
+	if !p.check(COLON) {
+		start = p.expression()
+	}
+
+	p.consume(COLON, "expect ':' in slice")
+
+	if !p.check(COLON) && !p.check(RIGHT_BRACKET) {
+		stop = p.expression()
+	}
+
+	if p.match(COLON) && !p.check(RIGHT_BRACKET) {
+		step = p.expression()
+	}
+
+	p.consume(RIGHT_BRACKET, "expect ']' after slice")
+
+	return &Slice{object, bracket, start, stop, step}
+}
+
 // finishCall returns a Call AST node with 0 or more arguments
 func (p *Parser) finishCall(callee Expr) Expr {
 	arguments := []Expr{}
@@ -484,3 +1087,47 @@ func (p *Parser) finishCall(callee Expr) Expr {
 
 	return &Call{callee, paren, arguments}
 }
+
+// sourceText rebuilds the source of an expression from its tokens,
+// spacing is normalized so "f( a+1 )" becomes "f(a + 1)"
+func sourceText(tokens []Token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && spaceBetween(tokens, i) {
+			b.WriteString(" ")
+		}
+		b.WriteString(t.lexeme)
+	}
+	return b.String()
+}
+
+func spaceBetween(tokens []Token, i int) bool {
+	prev, next := tokens[i-1].typ, tokens[i].typ
+
+	switch next {
+	case RIGHT_PAREN, RIGHT_BRACKET, COMMA, DOT, COLON:
+		return false
+	case LEFT_PAREN, LEFT_BRACKET:
+		// calls and slices
+		switch prev {
+		case IDENTIFIER, RIGHT_PAREN, RIGHT_BRACKET, STRING, THIS, SUPER, BANG:
+			return false
+		}
+	}
+
+	switch prev {
+	case LEFT_PAREN, LEFT_BRACKET, DOT, COLON:
+		return false
+	case BANG, MINUS:
+		// no space after a unary operator, which starts an expression or follows an operator
+		if i == 1 {
+			return false
+		}
+		switch tokens[i-2].typ {
+		case IDENTIFIER, PRIVATE_NAME, STRING, NUMBER, RIGHT_PAREN, RIGHT_BRACKET, THIS, TRUE, FALSE, NIL:
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package main
+
+type promiseState int
+
+const (
+	PENDING promiseState = iota
+	FULFILLED
+	REJECTED
+)
+
+// LoxPromise is returned by async functions and settles when they finish
+// its fields are guarded by the lock of the event loop, async functions
+// settle promises from their own goroutines
+type LoxPromise struct {
+	state     promiseState
+	value     interface{}
+	err       error    // RuntimeError of a rejected promise
+	handled   bool     // awaited, so a rejection isn't reported as unhandled
+	callbacks []func() // run on the event loop once settled
+}
+
+func NewLoxPromise() *LoxPromise {
+	return &LoxPromise{}
+}
+
+// onSettled schedules the callback on the event loop once the promise settles
+func (p *LoxPromise) onSettled(loop *EventLoop, callback func()) {
+	loop.lock.Lock()
+	defer loop.lock.Unlock()
+
+	p.handled = true
+	if p.state == PENDING {
+		p.callbacks = append(p.callbacks, callback)
+		return
+	}
+	loop.jobs = append(loop.jobs, callback)
+}
+
+// isPending returns true until the promise settles
+func (p *LoxPromise) isPending(loop *EventLoop) bool {
+	loop.lock.Lock()
+	defer loop.lock.Unlock()
+	return p.state == PENDING
+}
+
+// result returns the value of a settled promise or its error
+func (p *LoxPromise) result(loop *EventLoop) (interface{}, error) {
+	loop.lock.Lock()
+	defer loop.lock.Unlock()
+
+	p.handled = true
+	if p.state == REJECTED {
+		return nil, p.err
+	}
+	return p.value, nil
+}
+
+func (p *LoxPromise) String() string {
+	return "<promise>"
+}
+
+// coroutine runs an async function on its own goroutine, control is handed
+// back and forth so that only one of them runs at any time
+type coroutine struct {
+	resume  chan struct{}
+	suspend chan struct{}
+}
+
+func newCoroutine() *coroutine {
+	return &coroutine{make(chan struct{}), make(chan struct{})}
+}
+
+// run continues the coroutine and waits until it suspends or finishes
+func (c *coroutine) run() {
+	c.resume <- struct{}{}
+	<-c.suspend
+}
+
+// yield hands control back to whoever ran the coroutine and waits to be resumed
+func (c *coroutine) yield() {
+	c.suspend <- struct{}{}
+	<-c.resume
+}
+
+// startAsync calls an async function and returns its promise,
+// the function runs until its first await before the promise is returned
+func (i *Interpreter) startAsync(function *LoxFunction, args []interface{}) *LoxPromise {
+	promise := NewLoxPromise()
+	co := newCoroutine()
+	task := i.fork()
+	task.coroutine = co
+
+	go func() {
+		<-co.resume
+		value, err := function.execute(task, args)
+		i.loop.settle(promise, value, err)
+		co.suspend <- struct{}{}
+	}()
+
+	co.run()
+	return promise
+}
+
+// await waits for the promise to settle, suspending the current async function
+// at top-level the event loop runs until the promise settles
+func (i *Interpreter) await(keyword Token, promise *LoxPromise) (interface{}, error) {
+	if i.coroutine == nil {
+		for promise.isPending(i.loop) {
+			more, err := i.loop.step(i)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				return nil, NewRuntimeError(keyword, "awaited promise can never settle")
+			}
+		}
+		return promise.result(i.loop)
+	}
+
+	co := i.coroutine
+	promise.onSettled(i.loop, co.run)
+	co.yield()
+	return promise.result(i.loop)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// records are classes with immutable fields set positionally by the
+// generated initializer, see LoxClass.record
+// since the fields never change after construction they are read without locking
+
+func (l *LoxInstance) initRecord(args []interface{}) {
+	for i, field := range l.class.record.fields {
+		l.fields[field.lexeme] = args[i]
+	}
+}
+
+// recordMethod returns the methods generated for every record
+func (l *LoxInstance) recordMethod(name string) LoxCallable {
+	switch name {
+	case "with":
+		// copy with the given fields changed: p.with("x", 1, "y", 2)
+		return NewNativeFunction("with", VARIADIC, func(_ *Interpreter, args []interface{}) (interface{}, error) {
+			if len(args) == 0 || len(args)%2 != 0 {
+				return nil, NewCallError("'with' takes pairs of field names and values")
+			}
+
+			instance := NewLoxInstance(l.class)
+			for k, v := range l.fields {
+				instance.fields[k] = v
+			}
+			for i := 0; i < len(args); i += 2 {
+				field, ok := args[i].(string)
+				if _, exists := l.fields[field]; !ok || !exists {
+					return nil, NewCallError(fmt.Sprintf("record '%s' has no field '%v'", l.class.name, args[i]))
+				}
+				instance.fields[field] = args[i+1]
+			}
+			return instance, nil
+		})
+	case "toString":
+		return NewNativeFunction("toString", 0, func(_ *Interpreter, _ []interface{}) (interface{}, error) {
+			return l.recordString(), nil
+		})
+	}
+	return nil
+}
+
+func (l *LoxInstance) recordEquals(other *LoxInstance) bool {
+	if l.class.record != other.class.record {
+		return false
+	}
+	for _, field := range l.class.record.fields {
+		if !isEqual(l.fields[field.lexeme], other.fields[field.lexeme]) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordString formats a record as Point(x=1, y=2)
+func (l *LoxInstance) recordString() string {
+	fields := make([]string, len(l.class.record.fields))
+	for i, field := range l.class.record.fields {
+		fields[i] = field.lexeme + "=" + stringify(l.fields[field.lexeme])
+	}
+	return l.class.name + "(" + strings.Join(fields, ", ") + ")"
+}
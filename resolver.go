@@ -11,6 +11,16 @@ type Resolver struct {
 	currentFunction FunctionType
 	currentClass    ClassType
 	inLoop          bool
+	inAsync         bool     // await is allowed in async functions and at top-level
+	labels          []string // of the loops enclosing the current statement
+	// declarations seen so far, used for checking interface conformance
+	classes    map[string]*Class
+	traits     map[string]*Trait
+	interfaces map[string]*Interface
+	// variables assigned after their declaration, the TypeChecker only infers
+	// the types of variables which aren't
+	reassigned      map[Stmt]bool
+	assignedGlobals map[string]bool
 }
 
 type FunctionType string
@@ -20,6 +30,9 @@ const (
 	FUNCTION    FunctionType = "Function"
 	METHOD      FunctionType = "Method"
 	INITIALIZER FunctionType = "Initializer"
+	GETTER      FunctionType = "Getter"
+	SETTER      FunctionType = "Setter"
+	ABSTRACT    FunctionType = "Abstract"
 )
 
 type ClassType int
@@ -28,10 +41,16 @@ const (
 	NONE_CLASS ClassType = iota
 	CLASS_TYPE
 	SUBCLASS_TYPE
+	TRAIT_TYPE
+	EXTENSION_TYPE
 )
 
 func NewResolver(interpreter *Interpreter) *Resolver {
-	return &Resolver{interpreter, &Stack{}, NONE, NONE_CLASS, false}
+	return &Resolver{
+		interpreter, &Stack{}, NONE, NONE_CLASS, false, false, nil,
+		map[string]*Class{}, map[string]*Trait{}, map[string]*Interface{},
+		map[Stmt]bool{}, map[string]bool{},
+	}
 }
 
 /*
@@ -40,31 +59,71 @@ func NewResolver(interpreter *Interpreter) *Resolver {
 
 func (r *Resolver) visitBlockStmt(b *Block) interface{} {
 	r.beginScope()
+	r.hoist(b.statements)
 	r.resolve(b.statements)
 	r.endScope()
 	return nil
 }
 
 func (r *Resolver) visitClassStmt(c *Class) interface{} {
+	for _, decorator := range c.decorators {
+		r.resolveExpr(decorator)
+	}
+
 	enclosingClass := r.currentClass
 	r.currentClass = CLASS_TYPE
 
 	r.declare(c.name)
+	r.declaration(c.name, c)
 	r.define(c.name)
+	r.classes[c.name.lexeme] = c
 
 	if c.superclass != (Variable{}) {
 		r.currentClass = SUBCLASS_TYPE
-		superclass := c.superclass
-		if c.name.lexeme == superclass.name.lexeme {
-			fmt.Println(NewParseError(superclass.name, "a class can't inherit from itself"))
+		if c.name.lexeme == c.superclass.name.lexeme {
+			fmt.Println(NewParseError(c.superclass.name, "a class can't inherit from itself"))
 		}
-		r.resolveExpr(&superclass)
+		r.resolveExpr(&c.superclass)
 		r.beginScope()
 		r.scopes.peek().put("super", true)
 	}
 
-	r.beginScope()
-	r.scopes.peek().put("this", true)
+	// resolved in place since the interpreter evaluates these same nodes
+	used := map[string]bool{}
+	for j := range c.traits {
+		trait := &c.traits[j]
+		if used[trait.name.lexeme] {
+			fmt.Println(NewParseError(trait.name, "trait is already used by this class"))
+		}
+		used[trait.name.lexeme] = true
+		r.resolveExpr(trait)
+	}
+
+	for j := range c.interfaces {
+		r.resolveExpr(&c.interfaces[j])
+	}
+
+	// method decorators are evaluated when the class is created
+	for _, method := range c.methods {
+		if method.name.lexeme == "init" && len(method.decorators) > 0 {
+			fmt.Println(NewParseError(method.name, "can't decorate an initializer"))
+		}
+		if method.name.lexeme == "init" && method.async {
+			fmt.Println(NewParseError(method.name, "an initializer can't be async"))
+		}
+		for _, decorator := range method.decorators {
+			r.resolveExpr(decorator)
+		}
+	}
+
+	r.beginThisScope()
+
+	// field initializers are evaluated with "this" bound to the new instance
+	for _, field := range c.fields {
+		if field.initializer != nil {
+			r.resolveExpr(field.initializer)
+		}
+	}
 
 	for _, method := range c.methods {
 		declaration := METHOD
@@ -76,6 +135,22 @@ func (r *Resolver) visitClassStmt(c *Class) interface{} {
 		r.resolveFunction(&method, declaration)
 	}
 
+	r.checkMembers(c)
+
+	for _, getter := range c.getters {
+		r.resolveFunction(&getter, GETTER)
+	}
+
+	for _, setter := range c.setters {
+		r.resolveFunction(&setter, SETTER)
+	}
+
+	for _, abstract := range c.abstracts {
+		r.resolveFunction(&abstract, ABSTRACT)
+	}
+
+	r.checkConformance(c)
+
 	r.endScope()
 
 	if c.superclass != (Variable{}) {
@@ -86,8 +161,239 @@ func (r *Resolver) visitClassStmt(c *Class) interface{} {
 	return nil
 }
 
+func (r *Resolver) visitExtensionStmt(e *Extension) interface{} {
+	// builtin types aren't variables
+	if !isBuiltinType(e.target.name.lexeme) {
+		r.resolveExpr(&e.target)
+	}
+
+	enclosingClass := r.currentClass
+	r.currentClass = EXTENSION_TYPE
+
+	r.beginThisScope()
+
+	seen := map[string]bool{}
+	for _, method := range e.methods {
+		if method.name.lexeme == "init" {
+			fmt.Println(NewParseError(method.name, "can't add an initializer in an extension"))
+		}
+		if isPrivate(method.name.lexeme) {
+			fmt.Println(NewParseError(method.name, "can't add a private method in an extension"))
+		}
+		if seen[method.name.lexeme] {
+			fmt.Println(NewParseError(method.name, "already a method with this name in this extension"))
+		}
+		seen[method.name.lexeme] = true
+		r.resolveFunction(&method, METHOD)
+	}
+
+	r.endScope()
+
+	r.currentClass = enclosingClass
+	return nil
+}
+
+func (r *Resolver) visitTraitStmt(t *Trait) interface{} {
+	enclosingClass := r.currentClass
+	r.currentClass = TRAIT_TYPE
+
+	r.declare(t.name)
+	r.define(t.name)
+	r.traits[t.name.lexeme] = t
+
+	r.beginThisScope()
+
+	for _, method := range t.methods {
+		declaration := METHOD
+		if method.name.lexeme == "init" {
+			declaration = INITIALIZER
+		}
+		r.resolveFunction(&method, declaration)
+	}
+
+	r.endScope()
+
+	r.currentClass = enclosingClass
+	return nil
+}
+
+func (r *Resolver) visitInterfaceStmt(i *Interface) interface{} {
+	r.declare(i.name)
+	r.define(i.name)
+	r.interfaces[i.name.lexeme] = i
+
+	seen := map[string]bool{}
+	for _, method := range i.methods {
+		if seen[method.name.lexeme] {
+			fmt.Println(NewParseError(method.name, "already a method with this name in this interface"))
+		}
+		seen[method.name.lexeme] = true
+		r.resolveFunction(&method, ABSTRACT)
+	}
+	return nil
+}
+
+func (r *Resolver) visitEnumStmt(e *Enum) interface{} {
+	r.declare(e.name)
+	r.define(e.name)
+
+	seen := map[string]bool{}
+	for _, member := range e.members {
+		if seen[member.lexeme] {
+			fmt.Println(NewParseError(member, "already a member with this name in this enum"))
+		}
+		seen[member.lexeme] = true
+	}
+	return nil
+}
+
+func (r *Resolver) visitRecordStmt(rec *Record) interface{} {
+	r.declare(rec.name)
+	r.declaration(rec.name, rec)
+	r.define(rec.name)
+
+	seen := map[string]bool{}
+	for _, field := range rec.fields {
+		if seen[field.lexeme] {
+			fmt.Println(NewParseError(field, "already a field with this name in this record"))
+		}
+		seen[field.lexeme] = true
+	}
+	return nil
+}
+
+// checkConformance reports interface methods which are missing from a class or
+// don't take the same number of parameters as the interface declares
+func (r *Resolver) checkConformance(c *Class) {
+	methods, complete, abstract := r.classMethods(c)
+
+	for _, name := range c.interfaces {
+		iface, ok := r.interfaces[name.name.lexeme]
+		if !ok {
+			// can only be checked at runtime
+			continue
+		}
+		for _, signature := range iface.methods {
+			method, ok := methods[signature.name.lexeme]
+			if !ok {
+				// abstract classes leave the implementation to subclasses
+				if complete && !abstract {
+					msg := fmt.Sprintf("class doesn't implement '%s' from '%s'", signature.name.lexeme, iface.name.lexeme)
+					fmt.Println(NewParseError(c.name, msg))
+				}
+				continue
+			}
+			if len(method.params) != len(signature.params) {
+				msg := fmt.Sprintf("'%s' must take %d parameters to implement '%s'", signature.name.lexeme, len(signature.params), iface.name.lexeme)
+				fmt.Println(NewParseError(method.name, msg))
+			}
+		}
+	}
+}
+
+// classMethods collects the methods of a class including inherited and trait methods
+// complete is false if a superclass or trait isn't known statically
+// abstract is true if the class or any known superclass declares abstract methods
+func (r *Resolver) classMethods(c *Class) (methods map[string]*Function, complete bool, abstract bool) {
+	methods = map[string]*Function{}
+	complete = true
+
+	if c.superclass != (Variable{}) {
+		superclass, ok := r.classes[c.superclass.name.lexeme]
+		if ok && superclass != c {
+			methods, complete, abstract = r.classMethods(superclass)
+		} else {
+			complete = false
+		}
+	}
+
+	for _, name := range c.traits {
+		trait, ok := r.traits[name.name.lexeme]
+		if !ok {
+			complete = false
+			continue
+		}
+		for i := range trait.methods {
+			methods[trait.methods[i].name.lexeme] = &trait.methods[i]
+		}
+	}
+
+	for i := range c.abstracts {
+		methods[c.abstracts[i].name.lexeme] = &c.abstracts[i]
+	}
+
+	for i := range c.methods {
+		methods[c.methods[i].name.lexeme] = &c.methods[i]
+	}
+
+	return methods, complete, abstract || len(c.abstracts) > 0
+}
+
+// checkMembers reports fields, getters and setters that clash with other members
+func (r *Resolver) checkMembers(c *Class) {
+	methods := map[string]bool{}
+	for _, method := range c.methods {
+		methods[method.name.lexeme] = true
+	}
+
+	fields := map[string]bool{}
+	for _, field := range c.fields {
+		name := field.name
+		switch {
+		case methods[name.lexeme]:
+			fmt.Println(NewParseError(name, "a field and a method can't share a name"))
+		case fields[name.lexeme]:
+			fmt.Println(NewParseError(name, "already a field with this name in this class"))
+		}
+		fields[name.lexeme] = true
+	}
+
+	for _, abstract := range c.abstracts {
+		name := abstract.name
+		switch {
+		case name.lexeme == "init":
+			fmt.Println(NewParseError(name, "'init' can't be abstract"))
+		case methods[name.lexeme]:
+			fmt.Println(NewParseError(name, "an abstract method and a method can't share a name"))
+		}
+	}
+
+	getters := map[string]bool{}
+	for _, getter := range c.getters {
+		name := getter.name
+		switch {
+		case name.lexeme == "init":
+			fmt.Println(NewParseError(name, "'init' can't be a getter"))
+		case methods[name.lexeme]:
+			fmt.Println(NewParseError(name, "a getter and a method can't share a name"))
+		case fields[name.lexeme]:
+			fmt.Println(NewParseError(name, "a getter and a field can't share a name"))
+		case getters[name.lexeme]:
+			fmt.Println(NewParseError(name, "already a getter with this name in this class"))
+		}
+		getters[name.lexeme] = true
+	}
+
+	setters := map[string]bool{}
+	for _, setter := range c.setters {
+		name := setter.name
+		switch {
+		case name.lexeme == "init":
+			fmt.Println(NewParseError(name, "'init' can't be a setter"))
+		case methods[name.lexeme]:
+			fmt.Println(NewParseError(name, "a setter and a method can't share a name"))
+		case fields[name.lexeme]:
+			fmt.Println(NewParseError(name, "a setter and a field can't share a name"))
+		case setters[name.lexeme]:
+			fmt.Println(NewParseError(name, "already a setter with this name in this class"))
+		}
+		setters[name.lexeme] = true
+	}
+}
+
 func (r *Resolver) visitVarStmt(v *Var) interface{} {
 	r.declare(v.name)
+	r.declaration(v.name, v)
 	if v.initializer != nil {
 		r.resolveExpr(v.initializer)
 	}
@@ -97,8 +403,15 @@ func (r *Resolver) visitVarStmt(v *Var) interface{} {
 }
 
 func (r *Resolver) visitFunctionStmt(stmt *Function) interface{} {
-	r.declare(stmt.name)
-	r.define(stmt.name)
+	for _, decorator := range stmt.decorators {
+		r.resolveExpr(decorator)
+	}
+
+	// hoisted functions are already declared in local scopes
+	if r.scopes.isEmpty() || !isHoisted(stmt) {
+		r.declare(stmt.name)
+		r.define(stmt.name)
+	}
 
 	r.resolveFunction(stmt, FUNCTION)
 	return nil
@@ -132,24 +445,117 @@ func (r *Resolver) visitReturnStmt(stmt *Return) interface{} {
 		if r.currentFunction == INITIALIZER {
 			fmt.Println(NewParseError(stmt.keyword, "can't return a value from an initializer"))
 		}
+		if r.currentFunction == SETTER {
+			fmt.Println(NewParseError(stmt.keyword, "can't return a value from a setter"))
+		}
 		r.resolveExpr(stmt.value)
 	}
 	return nil
 }
 
 func (r *Resolver) visitBreakStmt(stmt *Break) interface{} {
+	r.checkJump(stmt.keyword, stmt.label)
+	return nil
+}
+
+func (r *Resolver) visitContinueStmt(stmt *Continue) interface{} {
+	r.checkJump(stmt.keyword, stmt.label)
+	return nil
+}
+
+// checkJump validates that a break or continue has a loop to jump out of
+func (r *Resolver) checkJump(keyword Token, label Token) {
 	if !r.inLoop {
-		fmt.Println(NewParseError(stmt.keyword, "can't use break outside loop"))
+		fmt.Println(NewParseError(keyword, "can't use "+keyword.lexeme+" outside loop"))
+		return
+	}
+	if label == (Token{}) {
+		return
+	}
+	for _, l := range r.labels {
+		if l == label.lexeme {
+			return
+		}
+	}
+	fmt.Println(NewParseError(label, "no enclosing loop labeled '"+label.lexeme+"'"))
+}
+
+// enterLoop marks that the loop body is being resolved and puts its label in scope
+func (r *Resolver) enterLoop(label Token) {
+	r.inLoop = true
+	if label == (Token{}) {
+		return
+	}
+	for _, l := range r.labels {
+		if l == label.lexeme {
+			fmt.Println(NewParseError(label, "label is already used by an enclosing loop"))
+		}
+	}
+	r.labels = append(r.labels, label.lexeme)
+}
+
+func (r *Resolver) visitForInStmt(stmt *ForIn) interface{} {
+	r.resolveExpr(stmt.iterable)
+
+	enclosedInLoop, enclosingLabels := r.inLoop, r.labels
+	r.enterLoop(stmt.label)
+
+	r.beginScope()
+	r.declare(stmt.name)
+	r.define(stmt.name)
+	r.resolveStmt(stmt.body)
+	r.endScope()
+
+	r.inLoop, r.labels = enclosedInLoop, enclosingLabels
+	return nil
+}
+
+func (r *Resolver) visitDeferStmt(stmt *Defer) interface{} {
+	if r.currentFunction == NONE {
+		fmt.Println(NewParseError(stmt.keyword, "can't use defer outside of a function"))
+	}
+
+	r.resolveExpr(stmt.call)
+	return nil
+}
+
+func (r *Resolver) visitSpawnStmt(stmt *Spawn) interface{} {
+	r.resolveExpr(stmt.call)
+	return nil
+}
+
+func (r *Resolver) visitSelectStmt(stmt *Select) interface{} {
+	for _, c := range stmt.cases {
+		r.resolveExpr(c.channel)
+		if c.value != nil {
+			r.resolveExpr(c.value)
+		}
+
+		r.beginScope()
+		if c.name != (Token{}) {
+			r.declare(c.name)
+			r.define(c.name)
+		}
+		r.hoist(c.body)
+		r.resolve(c.body)
+		r.endScope()
+	}
+
+	if stmt.fallback != nil {
+		r.resolveStmt(stmt.fallback)
 	}
 	return nil
 }
 
 func (r *Resolver) visitWhileStmt(stmt *While) interface{} {
-	enclosedInLoop := r.inLoop
-	r.inLoop = true
+	enclosedInLoop, enclosingLabels := r.inLoop, r.labels
+	r.enterLoop(stmt.label)
 	r.resolveExpr(stmt.condition)
 	r.resolveStmt(stmt.body)
-	r.inLoop = enclosedInLoop
+	if stmt.increment != nil {
+		r.resolveExpr(stmt.increment)
+	}
+	r.inLoop, r.labels = enclosedInLoop, enclosingLabels
 	return nil
 }
 
@@ -161,14 +567,24 @@ func (r *Resolver) resolveFunction(function *Function, typ FunctionType) {
 	enclosingFunction := r.currentFunction
 	r.currentFunction = typ
 
+	// break and continue can't jump out of a function
+	enclosedInLoop, enclosingLabels := r.inLoop, r.labels
+	r.inLoop, r.labels = false, nil
+
+	enclosingAsync := r.inAsync
+	r.inAsync = function.async
+
 	r.beginScope()
 	for _, param := range function.params {
 		r.declare(param)
 		r.define(param)
 	}
+	r.hoist(function.body)
 	r.resolve(function.body)
 	r.endScope()
 
+	r.inLoop, r.labels = enclosedInLoop, enclosingLabels
+	r.inAsync = enclosingAsync
 	r.currentFunction = enclosingFunction
 }
 
@@ -179,18 +595,33 @@ func (r *Resolver) resolveFunction(function *Function, typ FunctionType) {
 func (r *Resolver) visitVariableExpr(v *Variable) interface{} {
 	if !r.scopes.isEmpty() {
 		s := r.scopes.peek().get(v.name.lexeme)
-		if s != nil && *s == false {
+		if s != nil && !s.defined {
 			fmt.Println(NewParseError(v.name, "can't read local variable in its own initializer"))
 		}
 	}
 
-	r.resolveLocal(v, v.name)
+	r.resolveLocal(&v.binding, v.name)
 	return nil
 }
 
 func (r *Resolver) visitAssignExpr(a *Assign) interface{} {
 	r.resolveExpr(a.value)
-	r.resolveLocal(a, a.name)
+	r.resolveLocal(&a.binding, a.name)
+
+	if !a.binding.local {
+		r.assignedGlobals[a.name.lexeme] = true
+	} else if local := r.scopes.get(r.scopes.size() - 1 - a.binding.depth).get(a.name.lexeme); local.declaration != nil {
+		r.reassigned[local.declaration] = true
+	}
+	return nil
+}
+
+func (r *Resolver) visitAwaitExpr(a *Await) interface{} {
+	if r.currentFunction != NONE && !r.inAsync {
+		fmt.Println(NewParseError(a.keyword, "can only use await in async functions and top-level code"))
+	}
+
+	r.resolveExpr(a.value)
 	return nil
 }
 
@@ -211,6 +642,7 @@ func (r *Resolver) visitCallExpr(c *Call) interface{} {
 
 func (r *Resolver) visitGetExpr(g *Get) interface{} {
 	r.resolveExpr(g.object)
+	r.checkPrivateAccess(g.object, g.name)
 	return nil
 }
 
@@ -232,17 +664,74 @@ func (r *Resolver) visitLogicalExpr(l *Logical) interface{} {
 func (r *Resolver) visitSetExpr(s *Set) interface{} {
 	r.resolveExpr(s.value)
 	r.resolveExpr(s.object)
+	r.checkPrivateAccess(s.object, s.name)
+	return nil
+}
+
+// checkPrivateAccess allows private members to be used only through "this"
+func (r *Resolver) checkPrivateAccess(object Expr, name Token) {
+	if !isPrivate(name.lexeme) {
+		return
+	}
+	if _, ok := object.(*This); !ok {
+		fmt.Println(NewParseError(name, "private members can only be accessed through 'this'"))
+	} else if r.currentClass == EXTENSION_TYPE {
+		fmt.Println(NewParseError(name, "extension methods can't access private members"))
+	}
+}
+
+func (r *Resolver) visitAssertStmt(stmt *Assert) interface{} {
+	r.resolveExpr(stmt.condition)
+	if stmt.message != nil {
+		r.resolveExpr(stmt.message)
+	}
+	return nil
+}
+
+// visitTestStmt resolves the body like a block in the global scope
+func (r *Resolver) visitTestStmt(stmt *Test) interface{} {
+	if !r.scopes.isEmpty() {
+		fmt.Println(NewParseError(stmt.keyword, "test blocks can only be declared at top-level"))
+	}
+
+	r.beginScope()
+	r.hoist(stmt.body)
+	r.resolve(stmt.body)
+	r.endScope()
+	return nil
+}
+
+// macros are expanded and removed before resolving
+func (r *Resolver) visitMacroStmt(m *Macro) interface{} {
+	return nil
+}
+
+func (r *Resolver) visitMacroCallExpr(m *MacroCall) interface{} {
+	return nil
+}
+
+func (r *Resolver) visitSliceExpr(s *Slice) interface{} {
+	r.resolveExpr(s.object)
+	for _, bound := range []Expr{s.start, s.stop, s.step} {
+		if bound != nil {
+			r.resolveExpr(bound)
+		}
+	}
 	return nil
 }
 
 func (r *Resolver) visitSuperExpr(s *Super) interface{} {
 	if r.currentClass == NONE_CLASS {
 		fmt.Println(NewParseError(s.keyword, "can't use 'super' outside of a class"))
+	} else if r.currentClass == EXTENSION_TYPE {
+		fmt.Println(NewParseError(s.keyword, "can't use 'super' in an extension"))
+	} else if r.currentClass == TRAIT_TYPE {
+		fmt.Println(NewParseError(s.keyword, "can't use 'super' in a trait"))
 	} else if r.currentClass != SUBCLASS_TYPE {
 		fmt.Println(NewParseError(s.keyword, "can't use 'super' in a class with no superclass"))
 	}
 
-	r.resolveLocal(s, s.keyword)
+	r.resolveLocal(&s.binding, s.keyword)
 	return nil
 }
 
@@ -251,7 +740,7 @@ func (r *Resolver) visitThisExpr(t *This) interface{} {
 		fmt.Println(NewParseError(t.keyword, "can't use 'this' outside of a class"))
 		return nil
 	}
-	r.resolveLocal(t, t.keyword)
+	r.resolveLocal(&t.binding, t.keyword)
 	return nil
 }
 
@@ -264,27 +753,65 @@ func (r *Resolver) resolveExpr(expression Expr) {
 	expression.accept(r)
 }
 
-func (r *Resolver) resolveLocal(expr Expr, name Token) {
+// resolveLocal finds the scope declaring a name, names which aren't declared
+// in any local scope are globals
+func (r *Resolver) resolveLocal(binding *Binding, name Token) {
 	for i := r.scopes.size() - 1; i >= 0; i-- {
-		if r.scopes.get(i).containsKey(name.lexeme) {
-			r.interpreter.resolve(expr, r.scopes.size()-1-i)
+		if local := r.scopes.get(i).get(name.lexeme); local != nil {
+			*binding = Binding{true, r.scopes.size() - 1 - i, local.slot}
 			return
 		}
 	}
+	*binding = Binding{false, 0, r.interpreter.globals.index(name.lexeme)}
 }
 
 // Utility Methods
 
+// isReassigned returns true if a variable is assigned after its declaration,
+// globals are looked up by name since they can be assigned before they're declared
+func (r *Resolver) isReassigned(declaration Stmt, name Token, global bool) bool {
+	if global {
+		return r.assignedGlobals[name.lexeme]
+	}
+	return r.reassigned[declaration]
+}
+
 func (r *Resolver) resolve(statements []Stmt) {
 	for _, statement := range statements {
 		r.resolveStmt(statement)
 	}
 }
 
+// hoist declares the functions of a local scope before resolving its statements
+// so that they can call each other regardless of their order
+func (r *Resolver) hoist(statements []Stmt) {
+	for _, statement := range statements {
+		if f, ok := statement.(*Function); ok && isHoisted(f) {
+			r.declare(f.name)
+			r.define(f.name)
+		}
+	}
+}
+
+// isHoisted returns true for function declarations which are defined on entering
+// a local scope, decorated functions are defined when their statement runs since
+// the decorators may depend on earlier statements
+func isHoisted(f *Function) bool {
+	return len(f.decorators) == 0
+}
+
 func (r *Resolver) beginScope() {
 	r.scopes.push(Scope{})
 }
 
+// beginThisScope begins the scope of a method binding, "this" and the
+// declaring class are always in the first two slots, see LoxFunction.bindValue
+func (r *Resolver) beginThisScope() {
+	r.beginScope()
+	r.scopes.peek().put("this", true)
+	r.scopes.peek().put(thisClass, true)
+}
+
 func (r *Resolver) endScope() {
 	r.scopes.pop()
 }
@@ -304,6 +831,15 @@ func (r *Resolver) declare(name Token) {
 	scope.put(name.lexeme, false)
 }
 
+// declaration records the statement declaring a local so that assignments to it can be tracked
+func (r *Resolver) declaration(name Token, declaration Stmt) {
+	if r.scopes.isEmpty() {
+		return
+	}
+
+	r.scopes.peek().get(name.lexeme).declaration = declaration
+}
+
 func (r *Resolver) define(name Token) {
 	if r.scopes.isEmpty() {
 		return
@@ -312,17 +848,34 @@ func (r *Resolver) define(name Token) {
 	r.scopes.peek().put(name.lexeme, true)
 }
 
-type Scope map[string]bool
+// Binding is where a variable was resolved, a slot in the environment depth
+// levels up from the current one or an index in the globals table
+type Binding struct {
+	local bool
+	depth int
+	slot  int
+}
+
+// Scope holds the locals declared in a scope, their slots follow the order
+// in which the interpreter defines them in the scope's environment
+type Scope map[string]*Local
 
-func (m Scope) put(key string, value bool) {
-	m[key] = value
+type Local struct {
+	slot        int
+	defined     bool
+	declaration Stmt // nil for parameters and other implicit locals
 }
 
-func (m Scope) get(key string) *bool {
-	if v, ok := m[key]; ok {
-		return &v
+func (m Scope) put(key string, defined bool) {
+	if local, ok := m[key]; ok {
+		local.defined = defined
+		return
 	}
-	return nil
+	m[key] = &Local{len(m), defined, nil}
+}
+
+func (m Scope) get(key string) *Local {
+	return m[key]
 }
 
 func (m Scope) containsKey(key string) bool {
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Scanner struct {
@@ -11,19 +12,27 @@ type Scanner struct {
 	start   int // of lexeme
 	current int
 	line    int
+	// set by the "//glin:optional-semicolons" pragma
+	optionalSemicolons bool
 }
 
+const optionalSemicolonsPragma = "glin:optional-semicolons"
+
 var singleCharLexemes = map[byte]TokenType{
 	'(': LEFT_PAREN,
 	')': RIGHT_PAREN,
 	'{': LEFT_BRACE,
 	'}': RIGHT_BRACE,
+	'[': LEFT_BRACKET,
+	']': RIGHT_BRACKET,
 	',': COMMA,
 	'.': DOT,
 	'-': MINUS,
 	'+': PLUS,
 	';': SEMICOLON,
 	'*': STAR,
+	'@': AT,
+	':': COLON,
 }
 
 // lexemes that can have either 1 or 2 chars
@@ -35,23 +44,41 @@ var multiCharLexemes = map[byte][]TokenType{
 }
 
 var keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
-	"break":  BREAK,
+	"and":        AND,
+	"class":      CLASS,
+	"else":       ELSE,
+	"false":      FALSE,
+	"for":        FOR,
+	"fun":        FUN,
+	"if":         IF,
+	"nil":        NIL,
+	"or":         OR,
+	"print":      PRINT,
+	"return":     RETURN,
+	"super":      SUPER,
+	"this":       THIS,
+	"true":       TRUE,
+	"var":        VAR,
+	"while":      WHILE,
+	"break":      BREAK,
+	"trait":      TRAIT,
+	"with":       WITH,
+	"interface":  INTERFACE,
+	"implements": IMPLEMENTS,
+	"enum":       ENUM,
+	"in":         IN,
+	"record":     RECORD,
+	"defer":      DEFER,
+	"continue":   CONTINUE,
+	"spawn":      SPAWN,
+	"select":     SELECT,
+	"async":      ASYNC,
+	"await":      AWAIT,
+	"extend":     EXTEND,
+	"macro":      MACRO,
+	"assert":     ASSERT,
+	"test":       TEST,
+	"is":         IS,
 }
 
 func NewScanner(source string) *Scanner {
@@ -95,6 +122,10 @@ func (sc *Scanner) scanToken() {
 			for sc.peek() != '\n' && !sc.isAtEnd() {
 				sc.advance()
 			}
+			// trimmed so that the pragma is found in files with CRLF line endings
+			if strings.TrimSpace(sc.source[sc.start+2:sc.current]) == optionalSemicolonsPragma {
+				sc.optionalSemicolons = true
+			}
 		} else if sc.match('*') {
 			// block comments
 			commentClose := sc.peek() == '*' && sc.peekNext() == '/'
@@ -121,6 +152,12 @@ func (sc *Scanner) scanToken() {
 		// whitespace is ignored
 	case '"':
 		sc.string()
+	case '#':
+		if isAlpha(sc.peek()) {
+			sc.privateName()
+		} else {
+			fmt.Println(NewLexError(sc.line, "expect name after '#'"))
+		}
 	default:
 		if isDigit(c) {
 			sc.number()
@@ -185,6 +222,14 @@ func (sc *Scanner) identifer() {
 	}
 }
 
+// private name: identifier prefixed with '#' for class members
+func (sc *Scanner) privateName() {
+	for isAlphaNumeric(sc.peek()) {
+		sc.advance()
+	}
+	sc.addToken(PRIVATE_NAME, nil)
+}
+
 func (sc *Scanner) isAtEnd() bool {
 	return sc.current >= len(sc.source)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+)
+
+// sliceString slices a string by characters rather than bytes like Python,
+// nil bounds and step use the defaults, negative bounds count from the end
+// and out of range bounds are clamped
+func sliceString(s string, start, stop, step *int) string {
+	runes := []rune(s)
+	length := len(runes)
+
+	by := 1
+	if step != nil {
+		by = *step
+	}
+
+	lower, upper := 0, length
+	if by < 0 {
+		lower, upper = -1, length-1
+	}
+
+	bound := func(index *int, fallback int) int {
+		if index == nil {
+			return fallback
+		}
+		i := *index
+		if i < 0 {
+			i += length
+		}
+		if i < lower {
+			return lower
+		}
+		if i > upper {
+			return upper
+		}
+		return i
+	}
+
+	first, last := bound(start, lower), bound(stop, upper)
+	if by < 0 {
+		first, last = bound(start, upper), bound(stop, lower)
+	}
+
+	sliced := []rune{}
+	for i := first; (by > 0 && i < last) || (by < 0 && i > last); i += by {
+		sliced = append(sliced, runes[i])
+	}
+	return string(sliced)
+}
+
+// sliceBound converts a slice bound to an index, nil when it's left out
+func sliceBound(bracket Token, value interface{}) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	n, ok := value.(float64)
+	if !ok || n != math.Trunc(n) || math.IsInf(n, 0) {
+		return nil, NewRuntimeError(bracket, "slice indices must be integers or nil")
+	}
+	i := int(n)
+	return &i, nil
+}
@@ -4,14 +4,27 @@ package main
 type StmtVisitor interface {
 	visitBlockStmt(*Block) interface{}
 	visitClassStmt(*Class) interface{}
+	visitTraitStmt(*Trait) interface{}
+	visitInterfaceStmt(*Interface) interface{}
+	visitEnumStmt(*Enum) interface{}
+	visitRecordStmt(*Record) interface{}
+	visitExtensionStmt(*Extension) interface{}
 	visitExpressionStmt(*Expression) interface{}
 	visitFunctionStmt(*Function) interface{}
 	visitIfStmt(*If) interface{}
 	visitWhileStmt(*While) interface{}
+	visitForInStmt(*ForIn) interface{}
 	visitPrintStmt(*Print) interface{}
 	visitReturnStmt(*Return) interface{}
 	visitBreakStmt(*Break) interface{}
+	visitContinueStmt(*Continue) interface{}
+	visitDeferStmt(*Defer) interface{}
+	visitSpawnStmt(*Spawn) interface{}
+	visitSelectStmt(*Select) interface{}
 	visitVarStmt(*Var) interface{}
+	visitMacroStmt(*Macro) interface{}
+	visitAssertStmt(*Assert) interface{}
+	visitTestStmt(*Test) interface{}
 }
 
 type Stmt interface {
@@ -30,12 +43,64 @@ type Class struct {
 	name       Token
 	superclass Variable
 	methods    []Function
+	getters    []Function
+	setters    []Function
+	fields     []Var
+	traits     []Variable
+	interfaces []Variable
+	abstracts  []Function
+	decorators []Expr
 }
 
 func (c *Class) accept(visitor StmtVisitor) interface{} {
 	return visitor.visitClassStmt(c)
 }
 
+type Trait struct {
+	name    Token
+	methods []Function
+}
+
+func (t *Trait) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitTraitStmt(t)
+}
+
+type Interface struct {
+	name    Token
+	methods []Function
+}
+
+func (i *Interface) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitInterfaceStmt(i)
+}
+
+type Enum struct {
+	name    Token
+	members []Token
+}
+
+func (e *Enum) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitEnumStmt(e)
+}
+
+type Record struct {
+	name   Token
+	fields []Token
+}
+
+func (r *Record) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitRecordStmt(r)
+}
+
+type Extension struct {
+	target  Variable
+	methods []Function
+}
+
+func (e *Extension) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitExtensionStmt(e)
+}
+
 type Expression struct {
 	expression Expr
 }
@@ -45,9 +110,13 @@ func (e *Expression) accept(visitor StmtVisitor) interface{} {
 }
 
 type Function struct {
-	name   Token
-	params []Token
-	body   []Stmt
+	name       Token
+	params     []Token
+	paramTypes []Token
+	returnType Token
+	body       []Stmt
+	decorators []Expr
+	async      bool
 }
 
 func (f *Function) accept(visitor StmtVisitor) interface{} {
@@ -67,12 +136,26 @@ func (i *If) accept(visitor StmtVisitor) interface{} {
 type While struct {
 	condition Expr
 	body      Stmt
+	increment Expr
+	label     Token
 }
 
 func (w *While) accept(visitor StmtVisitor) interface{} {
 	return visitor.visitWhileStmt(w)
 }
 
+type ForIn struct {
+	keyword  Token
+	name     Token
+	iterable Expr
+	body     Stmt
+	label    Token
+}
+
+func (f *ForIn) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitForInStmt(f)
+}
+
 type Print struct {
 	expression Expr
 }
@@ -92,17 +175,87 @@ func (r *Return) accept(visitor StmtVisitor) interface{} {
 
 type Break struct {
 	keyword Token
+	label   Token
 }
 
 func (b *Break) accept(visitor StmtVisitor) interface{} {
 	return visitor.visitBreakStmt(b)
 }
 
+type Continue struct {
+	keyword Token
+	label   Token
+}
+
+func (c *Continue) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitContinueStmt(c)
+}
+
+type Defer struct {
+	keyword Token
+	call    *Call
+}
+
+func (d *Defer) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitDeferStmt(d)
+}
+
+type Spawn struct {
+	keyword Token
+	call    *Call
+}
+
+func (s *Spawn) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitSpawnStmt(s)
+}
+
+type Select struct {
+	keyword  Token
+	cases    []SelectCase
+	fallback Stmt
+}
+
+func (s *Select) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitSelectStmt(s)
+}
+
 type Var struct {
 	name        Token
+	annotation  Token
 	initializer Expr
 }
 
 func (v *Var) accept(visitor StmtVisitor) interface{} {
 	return visitor.visitVarStmt(v)
 }
+
+type Macro struct {
+	name   Token
+	params []Token
+	body   []Stmt
+}
+
+func (m *Macro) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitMacroStmt(m)
+}
+
+type Assert struct {
+	keyword   Token
+	condition Expr
+	message   Expr
+	source    string
+}
+
+func (a *Assert) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitAssertStmt(a)
+}
+
+type Test struct {
+	keyword Token
+	name    Token
+	body    []Stmt
+}
+
+func (t *Test) accept(visitor StmtVisitor) interface{} {
+	return visitor.visitTestStmt(t)
+}
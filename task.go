@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// deadlockGracePeriod is how long every task must stay blocked on channels
+// before a deadlock is reported, a task counted as blocked may not have
+// started waiting yet when the last one blocks
+const deadlockGracePeriod = 20 * time.Millisecond
+
+// TaskGroup tracks the tasks started by spawn statements so that
+// the interpreter can wait for them to finish, and the tasks blocked on
+// channels so that a deadlock raises an error instead of hanging
+type TaskGroup struct {
+	running  sync.WaitGroup
+	lastID   int32
+	lock     sync.Mutex
+	active   int           // tasks running Lox code, the main one included
+	blocked  int           // active tasks waiting on channels
+	changes  int           // counts blocking and unblocking to confirm a deadlock
+	deadlock chan struct{} // closed once every active task is blocked
+}
+
+func NewTaskGroup() *TaskGroup {
+	return &TaskGroup{active: 1, deadlock: make(chan struct{})}
+}
+
+// wait waits for the spawned tasks, the waiting task isn't active meanwhile
+func (t *TaskGroup) wait() {
+	t.leave()
+	t.running.Wait()
+	t.lock.Lock()
+	t.active++
+	t.lock.Unlock()
+}
+
+func (t *TaskGroup) leave() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.active--
+	t.changes++
+	t.checkDeadlock()
+}
+
+// checkDeadlock reports a deadlock once every active task has been
+// blocked for the grace period, it's called with the lock held
+func (t *TaskGroup) checkDeadlock() {
+	if t.blocked == 0 || t.blocked != t.active {
+		return
+	}
+	changes := t.changes
+	time.AfterFunc(deadlockGracePeriod, func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if t.changes == changes && t.blocked > 0 && t.blocked == t.active {
+			close(t.deadlock)
+			t.deadlock = make(chan struct{})
+		}
+	})
+}
+
+// choose waits for one of the cases like reflect.Select, deadlocked is
+// true if every task was blocked instead
+func (t *TaskGroup) choose(cases []reflect.SelectCase) (chosen int, value reflect.Value, ok bool, deadlocked bool) {
+	n := len(cases)
+	if n > 0 && cases[n-1].Dir == reflect.SelectDefault {
+		chosen, value, ok = reflect.Select(cases)
+		return chosen, value, ok, false
+	}
+
+	// cases which are ready don't count as blocking
+	chosen, value, ok = reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen < n {
+		return chosen, value, ok, false
+	}
+
+	t.lock.Lock()
+	deadlock := t.deadlock
+	t.blocked++
+	t.changes++
+	t.checkDeadlock()
+	t.lock.Unlock()
+
+	chosen, value, ok = reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(deadlock)}))
+
+	t.lock.Lock()
+	t.blocked--
+	t.changes++
+	t.lock.Unlock()
+	return chosen, value, ok, chosen == n
+}
+
+// spawn calls the function on a new goroutine, a RuntimeError ends
+// only the task that raised it
+func (i *Interpreter) spawn(keyword Token, function LoxCallable, paren Token, arguments []interface{}) {
+	id := atomic.AddInt32(&i.tasks.lastID, 1)
+	task := i.fork()
+
+	i.tasks.running.Add(1)
+	i.tasks.lock.Lock()
+	i.tasks.active++
+	i.tasks.lock.Unlock()
+	go func() {
+		defer i.tasks.running.Done()
+		defer i.tasks.leave()
+
+		if _, err := task.call(function, paren, arguments); err != nil {
+			fmt.Println(NewTaskError(id, keyword, function, err))
+		}
+	}()
+}
+
+// fork returns an interpreter for a new task, it shares the globals and
+// resolved variables but keeps its own current environment and deferred calls
+func (i *Interpreter) fork() *Interpreter {
+	return &Interpreter{nil, i.globals, false, nil, i.tasks, i.loop, i.builtins, nil}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// RunTests runs the test blocks of a program after the rest of it has been
+// interpreted and reports each result, every test gets its own environment
+// enclosed by the globals so that its variables don't leak into other tests
+func (i *Interpreter) RunTests(statements []Stmt) (passed int, failed int) {
+	return reportTests(statements, i.runTest)
+}
+
+// reportTests runs the test blocks with the given backend and prints the result of each
+func reportTests(statements []Stmt, run func(*Test) error) (passed int, failed int) {
+	for _, stmt := range statements {
+		test, ok := stmt.(*Test)
+		if !ok {
+			continue
+		}
+
+		name := test.name.literal
+		// a failed test doesn't make the whole run a runtime error,
+		// but an error raised before the tests still does
+		hadRuntimeErrorBefore := hadRuntimeError.get()
+		err := run(test)
+		hadRuntimeError.set(hadRuntimeErrorBefore)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %v\n%v", name, err)
+		} else {
+			passed++
+			fmt.Printf("ok   %v\n", name)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	return passed, failed
+}
+
+// runTest returns the RuntimeError which made the test fail, if any
+// timers and async functions started by the test run before it's finished
+func (i *Interpreter) runTest(test *Test) error {
+	defer i.tasks.wait()
+
+	if completion := i.executeBlock(test.body, NewEnvironment(nil)); completion != nil {
+		return completion.err
+	}
+	return i.runLoop()
+}
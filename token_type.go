@@ -10,6 +10,8 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
 	DOT
 	MINUS
@@ -17,6 +19,8 @@ const (
 	SEMICOLON
 	SLASH
 	STAR
+	AT
+	COLON
 
 	// one or two character tokens
 	BANG
@@ -30,6 +34,7 @@ const (
 
 	// Literals
 	IDENTIFIER
+	PRIVATE_NAME
 	STRING
 	NUMBER
 
@@ -51,6 +56,24 @@ const (
 	VAR
 	WHILE
 	BREAK
+	TRAIT
+	WITH
+	INTERFACE
+	IMPLEMENTS
+	ENUM
+	IN
+	RECORD
+	DEFER
+	CONTINUE
+	SPAWN
+	SELECT
+	ASYNC
+	AWAIT
+	EXTEND
+	MACRO
+	ASSERT
+	TEST
+	IS
 
 	// end of file
 	EOF
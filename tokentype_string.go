@@ -12,47 +12,70 @@ func _() {
 	_ = x[RIGHT_PAREN-1]
 	_ = x[LEFT_BRACE-2]
 	_ = x[RIGHT_BRACE-3]
-	_ = x[COMMA-4]
-	_ = x[DOT-5]
-	_ = x[MINUS-6]
-	_ = x[PLUS-7]
-	_ = x[SEMICOLON-8]
-	_ = x[SLASH-9]
-	_ = x[STAR-10]
-	_ = x[BANG-11]
-	_ = x[BANG_EQUAL-12]
-	_ = x[EQUAL-13]
-	_ = x[EQUAL_EQUAL-14]
-	_ = x[GREATER-15]
-	_ = x[GREATER_EQUAL-16]
-	_ = x[LESS-17]
-	_ = x[LESS_EQUAL-18]
-	_ = x[IDENTIFIER-19]
-	_ = x[STRING-20]
-	_ = x[NUMBER-21]
-	_ = x[AND-22]
-	_ = x[CLASS-23]
-	_ = x[ELSE-24]
-	_ = x[FALSE-25]
-	_ = x[FUN-26]
-	_ = x[FOR-27]
-	_ = x[IF-28]
-	_ = x[NIL-29]
-	_ = x[OR-30]
-	_ = x[PRINT-31]
-	_ = x[RETURN-32]
-	_ = x[SUPER-33]
-	_ = x[THIS-34]
-	_ = x[TRUE-35]
-	_ = x[VAR-36]
-	_ = x[WHILE-37]
-	_ = x[BREAK-38]
-	_ = x[EOF-39]
+	_ = x[LEFT_BRACKET-4]
+	_ = x[RIGHT_BRACKET-5]
+	_ = x[COMMA-6]
+	_ = x[DOT-7]
+	_ = x[MINUS-8]
+	_ = x[PLUS-9]
+	_ = x[SEMICOLON-10]
+	_ = x[SLASH-11]
+	_ = x[STAR-12]
+	_ = x[AT-13]
+	_ = x[COLON-14]
+	_ = x[BANG-15]
+	_ = x[BANG_EQUAL-16]
+	_ = x[EQUAL-17]
+	_ = x[EQUAL_EQUAL-18]
+	_ = x[GREATER-19]
+	_ = x[GREATER_EQUAL-20]
+	_ = x[LESS-21]
+	_ = x[LESS_EQUAL-22]
+	_ = x[IDENTIFIER-23]
+	_ = x[PRIVATE_NAME-24]
+	_ = x[STRING-25]
+	_ = x[NUMBER-26]
+	_ = x[AND-27]
+	_ = x[CLASS-28]
+	_ = x[ELSE-29]
+	_ = x[FALSE-30]
+	_ = x[FUN-31]
+	_ = x[FOR-32]
+	_ = x[IF-33]
+	_ = x[NIL-34]
+	_ = x[OR-35]
+	_ = x[PRINT-36]
+	_ = x[RETURN-37]
+	_ = x[SUPER-38]
+	_ = x[THIS-39]
+	_ = x[TRUE-40]
+	_ = x[VAR-41]
+	_ = x[WHILE-42]
+	_ = x[BREAK-43]
+	_ = x[TRAIT-44]
+	_ = x[WITH-45]
+	_ = x[INTERFACE-46]
+	_ = x[IMPLEMENTS-47]
+	_ = x[ENUM-48]
+	_ = x[IN-49]
+	_ = x[RECORD-50]
+	_ = x[DEFER-51]
+	_ = x[CONTINUE-52]
+	_ = x[SPAWN-53]
+	_ = x[SELECT-54]
+	_ = x[ASYNC-55]
+	_ = x[AWAIT-56]
+	_ = x[EXTEND-57]
+	_ = x[MACRO-58]
+	_ = x[ASSERT-59]
+	_ = x[TEST-60]
+	_ = x[IS-61]
+	_ = x[EOF-62]
 }
 
-const _TokenType_name = "LEFT_PARENRIGHT_PARENLEFT_BRACERIGHT_BRACECOMMADOTMINUSPLUSSEMICOLONSLASHSTARBANGBANG_EQUALEQUALEQUAL_EQUALGREATERGREATER_EQUALLESSLESS_EQUALIDENTIFIERSTRINGNUMBERANDCLASSELSEFALSEFUNFORIFNILORPRINTRETURNSUPERTHISTRUEVARWHILEBREAKEOF"
+const _TokenType_name = "LEFT_PARENRIGHT_PARENLEFT_BRACERIGHT_BRACELEFT_BRACKETRIGHT_BRACKETCOMMADOTMINUSPLUSSEMICOLONSLASHSTARATCOLONBANGBANG_EQUALEQUALEQUAL_EQUALGREATERGREATER_EQUALLESSLESS_EQUALIDENTIFIERPRIVATE_NAMESTRINGNUMBERANDCLASSELSEFALSEFUNFORIFNILORPRINTRETURNSUPERTHISTRUEVARWHILEBREAKTRAITWITHINTERFACEIMPLEMENTSENUMINRECORDDEFERCONTINUESPAWNSELECTASYNCAWAITEXTENDMACROASSERTTESTISEOF"
 
-var _TokenType_index = [...]uint8{0, 10, 21, 31, 42, 47, 50, 55, 59, 68, 73, 77, 81, 91, 96, 107, 114, 127, 131, 141, 151, 157, 163, 166, 171, 175, 180, 183, 186, 188, 191, 193, 198, 204, 209, 213, 217, 220, 225, 230, 233}
+var _TokenType_index = [...]uint16{0, 10, 21, 31, 42, 54, 67, 72, 75, 80, 84, 93, 98, 102, 104, 109, 113, 123, 128, 139, 146, 159, 163, 173, 183, 195, 201, 207, 210, 215, 219, 224, 227, 230, 232, 235, 237, 242, 248, 253, 257, 261, 264, 269, 274, 279, 283, 292, 302, 306, 308, 314, 319, 327, 332, 338, 343, 348, 354, 359, 365, 369, 371, 374}
 
 func (i TokenType) String() string {
 	if i < 0 || i >= TokenType(len(_TokenType_index)-1) {
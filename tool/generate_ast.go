@@ -17,31 +17,51 @@ func main() {
 	outputDir := args[0]
 
 	defineAst(outputDir, "Expr", []string{
-		"Assign   : name Token, value Expr",
+		"Assign   : name Token, value Expr, binding Binding",
+		"Await    : keyword Token, value Expr",
 		"Binary   : left Expr, operator Token, right Expr",
 		"Call     : callee Expr, paren Token, arguments []Expr",
 		"Get      : object Expr, name Token",
 		"Grouping : expression Expr",
 		"Literal  : value interface{}",
 		"Logical  : left Expr, operator Token, right Expr",
+		"MacroCall: name Token, arguments []Stmt",
 		"Set      : object Expr, name Token, value Expr",
-		"Super    : keyword Token, method Token",
-		"This     : keyword Token",
+		"Slice    : object Expr, bracket Token, start Expr, stop Expr, step Expr",
+		"Super    : keyword Token, method Token, binding Binding",
+		"This     : keyword Token, binding Binding",
 		"Unary    : operator Token, right Expr",
-		"Variable : name Token",
+		"Variable : name Token, binding Binding",
 	})
 
 	defineAst(outputDir, "Stmt", []string{
 		"Block      : statements []Stmt",
-		"Class      : name Token, superclass Variable, methods []Function",
+		"Class      : name Token, superclass Variable, methods []Function, " +
+			"getters []Function, setters []Function, fields []Var, " +
+			"traits []Variable, interfaces []Variable, abstracts []Function, " +
+			"decorators []Expr",
+		"Trait      : name Token, methods []Function",
+		"Interface  : name Token, methods []Function",
+		"Enum       : name Token, members []Token",
+		"Record     : name Token, fields []Token",
+		"Extension  : target Variable, methods []Function",
 		"Expression : expression Expr",
-		"Function   : name Token, params []Token, body []Stmt",
+		"Function   : name Token, params []Token, paramTypes []Token, returnType Token, " +
+			"body []Stmt, decorators []Expr, async bool",
 		"If         : condition Expr, thenBranch Stmt, " + "elseBranch Stmt",
-		"While		: condition Expr, body Stmt",
+		"While		: condition Expr, body Stmt, increment Expr, label Token",
+		"ForIn      : keyword Token, name Token, iterable Expr, body Stmt, label Token",
 		"Print      : expression Expr",
 		"Return     : keyword Token, value Expr",
-		"Break		: keyword Token",
-		"Var        : name Token, initializer Expr",
+		"Break		: keyword Token, label Token",
+		"Continue   : keyword Token, label Token",
+		"Defer      : keyword Token, call *Call",
+		"Spawn      : keyword Token, call *Call",
+		"Select     : keyword Token, cases []SelectCase, fallback Stmt",
+		"Var        : name Token, annotation Token, initializer Expr",
+		"Macro      : name Token, params []Token, body []Stmt",
+		"Assert     : keyword Token, condition Expr, message Expr, source string",
+		"Test       : keyword Token, name Token, body []Stmt",
 	})
 }
 
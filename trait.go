@@ -0,0 +1,15 @@
+package main
+
+// LoxTrait holds methods that are copied into the classes using it
+type LoxTrait struct {
+	name    string
+	methods map[string]LoxFunction
+}
+
+func NewLoxTrait(name string, methods map[string]LoxFunction) *LoxTrait {
+	return &LoxTrait{name, methods}
+}
+
+func (l *LoxTrait) String() string {
+	return l.name
+}
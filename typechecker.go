@@ -0,0 +1,749 @@
+package main
+
+import (
+	"fmt"
+)
+
+// TypeChecker implements ExprVisitor, StmtVisitor
+// It checks type annotations after the program is resolved, values without
+// an annotation have the type Any unless they are local variables whose
+// type can be inferred from their initializer because they're never reassigned
+type TypeChecker struct {
+	resolver     *Resolver // knows which variables are reassigned
+	globals      map[string]Type
+	scopes       []map[string]Type
+	returnType   Type         // of the function being checked, nil at top-level
+	currentClass *StaticClass // nil outside classes and inside traits
+}
+
+func NewTypeChecker(resolver *Resolver) *TypeChecker {
+	return &TypeChecker{resolver, map[string]Type{}, nil, nil, nil}
+}
+
+func (c *TypeChecker) check(statements []Stmt) {
+	for _, statement := range statements {
+		c.checkStmt(statement)
+	}
+}
+
+/*
+ * StmtVisitor implementation
+ */
+
+func (c *TypeChecker) visitBlockStmt(b *Block) interface{} {
+	c.beginScope()
+	c.hoist(b.statements)
+	c.check(b.statements)
+	c.endScope()
+	return nil
+}
+
+func (c *TypeChecker) visitClassStmt(stmt *Class) interface{} {
+	for _, decorator := range stmt.decorators {
+		c.checkExpr(decorator)
+	}
+
+	class := NewStaticClass(stmt.name.lexeme)
+
+	// a decorator can replace the class with any value
+	if len(stmt.decorators) > 0 || c.isReassigned(stmt, stmt.name) {
+		c.define(stmt.name, AnyType)
+	} else {
+		c.define(stmt.name, class)
+	}
+
+	if stmt.superclass != (Variable{}) {
+		if superclass, ok := c.checkExpr(&stmt.superclass).(*StaticClass); ok {
+			class.superclass = superclass
+		}
+	}
+
+	for _, v := range stmt.interfaces {
+		if iface, ok := c.checkExpr(&v).(*StaticClass); ok && iface.kind == "Interface" {
+			class.interfaces = append(class.interfaces, iface)
+		}
+	}
+
+	// signatures are collected first so that methods can use each other
+	for _, method := range stmt.methods {
+		signature := c.signature(&method)
+		if method.name.lexeme == "init" {
+			signature.returns = InstanceType{class}
+			class.init = signature
+		} else if len(method.decorators) > 0 {
+			class.methods[method.name.lexeme] = AnyType
+		} else {
+			class.methods[method.name.lexeme] = signature
+		}
+	}
+
+	for _, abstract := range stmt.abstracts {
+		class.methods[abstract.name.lexeme] = c.signature(&abstract)
+	}
+
+	for _, getter := range stmt.getters {
+		class.fields[getter.name.lexeme] = c.resolveType(getter.returnType)
+	}
+
+	for _, setter := range stmt.setters {
+		class.setters[setter.name.lexeme] = c.resolveType(setter.paramTypes[0])
+	}
+
+	for _, field := range stmt.fields {
+		class.fields[field.name.lexeme] = c.resolveType(field.annotation)
+	}
+
+	enclosingClass := c.currentClass
+	c.currentClass = class
+
+	for _, field := range stmt.fields {
+		if field.initializer != nil {
+			c.checkAssignable(field.name, class.fields[field.name.lexeme], c.checkExpr(field.initializer), "field '"+field.name.lexeme+"'")
+		}
+	}
+
+	for _, method := range stmt.methods {
+		c.checkFunction(&method, methodType(&method))
+	}
+
+	for _, getter := range stmt.getters {
+		c.checkFunction(&getter, METHOD)
+	}
+
+	for _, setter := range stmt.setters {
+		c.checkFunction(&setter, METHOD)
+	}
+
+	c.currentClass = enclosingClass
+	return nil
+}
+
+func (c *TypeChecker) visitExtensionStmt(e *Extension) interface{} {
+	var class *StaticClass
+	if !isBuiltinType(e.target.name.lexeme) {
+		class, _ = c.checkExpr(&e.target).(*StaticClass)
+	}
+
+	if class != nil {
+		for _, method := range e.methods {
+			class.methods[method.name.lexeme] = c.signature(&method)
+		}
+	}
+
+	// "this" is Any in extensions of builtin types
+	enclosingClass := c.currentClass
+	c.currentClass = class
+
+	for _, method := range e.methods {
+		c.checkFunction(&method, METHOD)
+	}
+
+	c.currentClass = enclosingClass
+	return nil
+}
+
+func (c *TypeChecker) visitTraitStmt(t *Trait) interface{} {
+	c.define(t.name, AnyType)
+
+	// "this" can be an instance of any class using the trait
+	enclosingClass := c.currentClass
+	c.currentClass = nil
+
+	for _, method := range t.methods {
+		c.checkFunction(&method, methodType(&method))
+	}
+
+	c.currentClass = enclosingClass
+	return nil
+}
+
+func (c *TypeChecker) visitInterfaceStmt(i *Interface) interface{} {
+	iface := NewStaticInterface(i.name.lexeme)
+	for _, method := range i.methods {
+		iface.methods[method.name.lexeme] = c.signature(&method)
+	}
+	c.define(i.name, iface)
+	return nil
+}
+
+func (c *TypeChecker) visitEnumStmt(e *Enum) interface{} {
+	c.define(e.name, NewStaticEnum(e.name.lexeme, e.members))
+	return nil
+}
+
+func (c *TypeChecker) visitRecordStmt(r *Record) interface{} {
+	class := NewStaticClass(r.name.lexeme)
+	params := make([]Type, len(r.fields))
+	for i, field := range r.fields {
+		params[i] = AnyType
+		class.fields[field.lexeme] = AnyType
+	}
+	class.init = &Signature{params, InstanceType{class}}
+	if c.isReassigned(r, r.name) {
+		c.define(r.name, AnyType)
+	} else {
+		c.define(r.name, class)
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitExpressionStmt(stmt *Expression) interface{} {
+	c.checkExpr(stmt.expression)
+	return nil
+}
+
+func (c *TypeChecker) visitFunctionStmt(stmt *Function) interface{} {
+	for _, decorator := range stmt.decorators {
+		c.checkExpr(decorator)
+	}
+
+	// hoisted functions are already defined in local scopes
+	if len(c.scopes) == 0 || !isHoisted(stmt) {
+		c.define(stmt.name, c.functionType(stmt))
+	}
+
+	c.checkFunction(stmt, FUNCTION)
+	return nil
+}
+
+func (c *TypeChecker) visitIfStmt(stmt *If) interface{} {
+	c.checkExpr(stmt.condition)
+	c.checkStmt(stmt.thenBranch)
+	if stmt.elseBranch != nil {
+		c.checkStmt(stmt.elseBranch)
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitWhileStmt(stmt *While) interface{} {
+	c.checkExpr(stmt.condition)
+	c.checkStmt(stmt.body)
+	if stmt.increment != nil {
+		c.checkExpr(stmt.increment)
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitForInStmt(stmt *ForIn) interface{} {
+	c.checkExpr(stmt.iterable)
+
+	c.beginScope()
+	c.define(stmt.name, AnyType)
+	c.checkStmt(stmt.body)
+	c.endScope()
+	return nil
+}
+
+func (c *TypeChecker) visitPrintStmt(stmt *Print) interface{} {
+	c.checkExpr(stmt.expression)
+	return nil
+}
+
+func (c *TypeChecker) visitReturnStmt(stmt *Return) interface{} {
+	var value Type = NilType
+	if stmt.value != nil {
+		value = c.checkExpr(stmt.value)
+	}
+
+	if c.returnType != nil {
+		c.checkAssignable(stmt.keyword, c.returnType, value, "return value")
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitBreakStmt(_ *Break) interface{} {
+	return nil
+}
+
+func (c *TypeChecker) visitContinueStmt(_ *Continue) interface{} {
+	return nil
+}
+
+func (c *TypeChecker) visitDeferStmt(stmt *Defer) interface{} {
+	c.checkExpr(stmt.call)
+	return nil
+}
+
+func (c *TypeChecker) visitSpawnStmt(stmt *Spawn) interface{} {
+	c.checkExpr(stmt.call)
+	return nil
+}
+
+func (c *TypeChecker) visitSelectStmt(stmt *Select) interface{} {
+	for _, sc := range stmt.cases {
+		c.checkExpr(sc.channel)
+		if sc.value != nil {
+			c.checkExpr(sc.value)
+		}
+
+		c.beginScope()
+		if sc.name != (Token{}) {
+			c.define(sc.name, AnyType)
+		}
+		c.hoist(sc.body)
+		c.check(sc.body)
+		c.endScope()
+	}
+
+	if stmt.fallback != nil {
+		c.checkStmt(stmt.fallback)
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitVarStmt(stmt *Var) interface{} {
+	declared := c.resolveType(stmt.annotation)
+
+	if stmt.initializer != nil {
+		value := c.checkExpr(stmt.initializer)
+		if stmt.annotation != (Token{}) {
+			c.checkAssignable(stmt.name, declared, value, "variable '"+stmt.name.lexeme+"'")
+		} else if len(c.scopes) > 0 && value != NilType && !c.isReassigned(stmt, stmt.name) {
+			// globals stay Any since they can be redeclared
+			c.define(stmt.name, value)
+			return nil
+		}
+	}
+
+	c.define(stmt.name, declared)
+	return nil
+}
+
+/*
+ * ExprVisitor implementation
+ */
+
+func (c *TypeChecker) visitAssignExpr(a *Assign) interface{} {
+	value := c.checkExpr(a.value)
+	c.checkAssignable(a.name, c.lookup(a.name), value, "variable '"+a.name.lexeme+"'")
+	return value
+}
+
+func (c *TypeChecker) visitAwaitExpr(a *Await) interface{} {
+	c.checkExpr(a.value)
+	return AnyType
+}
+
+func (c *TypeChecker) visitBinaryExpr(b *Binary) interface{} {
+	left := c.checkExpr(b.left)
+	right := c.checkExpr(b.right)
+
+	switch b.operator.typ {
+	case PLUS:
+		for _, operand := range []Type{left, right} {
+			if !isAssignable(NumberType, operand) && !isAssignable(StringType, operand) {
+				c.error(b.operator, fmt.Sprintf("operands must be numbers or strings but got '%v' and '%v'", left, right))
+				return AnyType
+			}
+		}
+		if left == NumberType && right == NumberType {
+			return NumberType
+		}
+		// a string concatenated with anything that isn't an error is a string
+		if left == StringType || right == StringType {
+			return StringType
+		}
+		return AnyType
+	case MINUS, SLASH, STAR:
+		c.checkNumbers(b.operator, left, right)
+		return NumberType
+	case GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		c.checkNumbers(b.operator, left, right)
+		return BoolType
+	case EQUAL_EQUAL, BANG_EQUAL:
+		return BoolType
+	case IS:
+		if _, ok := right.(*StaticClass); !ok && right != AnyType {
+			c.error(b.operator, "right operand of 'is' must be a class but got '"+right.String()+"'")
+		}
+		return BoolType
+	}
+
+	return AnyType
+}
+
+func (c *TypeChecker) visitCallExpr(call *Call) interface{} {
+	callee := c.checkExpr(call.callee)
+
+	arguments := make([]Type, len(call.arguments))
+	for i, argument := range call.arguments {
+		arguments[i] = c.checkExpr(argument)
+	}
+
+	var signature *Signature
+	switch t := callee.(type) {
+	case *Signature:
+		signature = t
+	case *StaticClass:
+		if t.kind != "Class" {
+			c.error(call.paren, "can only call functions and classes")
+			return AnyType
+		}
+		signature = t.constructor()
+	case InstanceType:
+		c.error(call.paren, "can only call functions and classes")
+		return AnyType
+	case SimpleType:
+		if t != AnyType && t != CallableType {
+			c.error(call.paren, "can only call functions and classes")
+		}
+		return AnyType
+	}
+
+	if len(arguments) != len(signature.params) {
+		c.error(call.paren, fmt.Sprintf("expected %d arguments but got %d", len(signature.params), len(arguments)))
+		return signature.returns
+	}
+
+	for i, argument := range arguments {
+		c.checkAssignable(call.paren, signature.params[i], argument, fmt.Sprintf("argument %d", i+1))
+	}
+
+	return signature.returns
+}
+
+func (c *TypeChecker) visitGetExpr(g *Get) interface{} {
+	object := c.checkExpr(g.object)
+
+	switch t := object.(type) {
+	case InstanceType:
+		return t.class.property(g.name.lexeme)
+	case *StaticClass:
+		if t.members[g.name.lexeme] {
+			return InstanceType{t}
+		}
+	case SimpleType:
+		// builtin types can get methods from extensions at any time
+		if t == NilType {
+			c.error(g.name, "only instances have properties, got '"+t.String()+"'")
+		}
+	}
+
+	return AnyType
+}
+
+func (c *TypeChecker) visitGroupingExpr(g *Grouping) interface{} {
+	return c.checkExpr(g.expression)
+}
+
+func (c *TypeChecker) visitLiteralExpr(l *Literal) interface{} {
+	switch l.value.(type) {
+	case float64:
+		return NumberType
+	case string:
+		return StringType
+	case bool:
+		return BoolType
+	case nil:
+		return NilType
+	}
+	return AnyType
+}
+
+func (c *TypeChecker) visitLogicalExpr(l *Logical) interface{} {
+	left := c.checkExpr(l.left)
+	right := c.checkExpr(l.right)
+	return joinTypes(left, right)
+}
+
+func (c *TypeChecker) visitSetExpr(s *Set) interface{} {
+	value := c.checkExpr(s.value)
+	object := c.checkExpr(s.object)
+
+	if t, ok := object.(InstanceType); ok {
+		for class := t.class; class != nil; class = class.superclass {
+			if param, ok := class.setters[s.name.lexeme]; ok {
+				c.checkAssignable(s.name, param, value, "property '"+s.name.lexeme+"'")
+				break
+			}
+			if field, ok := class.fields[s.name.lexeme]; ok {
+				c.checkAssignable(s.name, field, value, "property '"+s.name.lexeme+"'")
+				break
+			}
+		}
+	}
+
+	return value
+}
+
+func (c *TypeChecker) visitAssertStmt(stmt *Assert) interface{} {
+	c.checkExpr(stmt.condition)
+	if stmt.message != nil {
+		c.checkExpr(stmt.message)
+	}
+	return nil
+}
+
+func (c *TypeChecker) visitTestStmt(stmt *Test) interface{} {
+	c.beginScope()
+	c.hoist(stmt.body)
+	c.check(stmt.body)
+	c.endScope()
+	return nil
+}
+
+// macros are expanded and removed before type checking
+func (c *TypeChecker) visitMacroStmt(m *Macro) interface{} {
+	return nil
+}
+
+func (c *TypeChecker) visitMacroCallExpr(m *MacroCall) interface{} {
+	return AnyType
+}
+
+func (c *TypeChecker) visitSliceExpr(s *Slice) interface{} {
+	object := c.checkExpr(s.object)
+
+	for _, bound := range []Expr{s.start, s.stop, s.step} {
+		if bound == nil {
+			continue
+		}
+		if t := c.checkExpr(bound); !isAssignable(NumberType, t) && t != NilType {
+			c.error(s.bracket, "slice indices must be numbers but got '"+t.String()+"'")
+		}
+	}
+
+	if !isAssignable(StringType, object) {
+		c.error(s.bracket, "only strings can be sliced, got '"+object.String()+"'")
+		return AnyType
+	}
+	return StringType
+}
+
+func (c *TypeChecker) visitSuperExpr(s *Super) interface{} {
+	if c.currentClass == nil || c.currentClass.superclass == nil {
+		return AnyType
+	}
+	return c.currentClass.superclass.property(s.method.lexeme)
+}
+
+func (c *TypeChecker) visitThisExpr(_ *This) interface{} {
+	if c.currentClass == nil {
+		return AnyType
+	}
+	return InstanceType{c.currentClass}
+}
+
+func (c *TypeChecker) visitUnaryExpr(u *Unary) interface{} {
+	right := c.checkExpr(u.right)
+
+	switch u.operator.typ {
+	case MINUS:
+		if !isAssignable(NumberType, right) {
+			c.error(u.operator, "operand must be a number but got '"+right.String()+"'")
+		}
+		return NumberType
+	case BANG:
+		return BoolType
+	}
+
+	return AnyType
+}
+
+func (c *TypeChecker) visitVariableExpr(v *Variable) interface{} {
+	return c.lookup(v.name)
+}
+
+/*
+ * Utility Methods
+ */
+
+func (c *TypeChecker) checkStmt(statement Stmt) {
+	statement.accept(c)
+}
+
+func (c *TypeChecker) checkExpr(expression Expr) Type {
+	return expression.accept(c).(Type)
+}
+
+func (c *TypeChecker) checkFunction(function *Function, typ FunctionType) {
+	enclosingReturnType := c.returnType
+	c.returnType = c.resolveType(function.returnType)
+
+	c.beginScope()
+	for i, param := range function.params {
+		c.define(param, c.resolveType(function.paramTypes[i]))
+	}
+	c.hoist(function.body)
+	c.check(function.body)
+	c.endScope()
+
+	// a body which can complete without a return statement returns nil
+	if !alwaysReturns(function.body) && typ != INITIALIZER {
+		c.checkAssignable(function.name, c.returnType, NilType, "implicit return value")
+	}
+
+	c.returnType = enclosingReturnType
+}
+
+// alwaysReturns returns true if statements can't complete without running a return statement
+func alwaysReturns(statements []Stmt) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	switch s := statements[len(statements)-1].(type) {
+	case *Return:
+		return true
+	case *Block:
+		return alwaysReturns(s.statements)
+	case *If:
+		return s.elseBranch != nil && alwaysReturns([]Stmt{s.thenBranch}) && alwaysReturns([]Stmt{s.elseBranch})
+	case *While:
+		// an infinite loop can only be left by a return statement
+		condition, ok := s.condition.(*Literal)
+		return ok && condition.value == true && !breaksOut(s.body, s.label, false)
+	}
+	return false
+}
+
+// breaksOut returns true if a statement can break out of the loop with the given label,
+// unlabelled breaks in nested loops break out of those instead
+func breaksOut(statement Stmt, label Token, nested bool) bool {
+	switch s := statement.(type) {
+	case *Break:
+		if s.label == (Token{}) {
+			return !nested
+		}
+		return label != (Token{}) && s.label.lexeme == label.lexeme
+	case *Block:
+		for _, statement := range s.statements {
+			if breaksOut(statement, label, nested) {
+				return true
+			}
+		}
+	case *If:
+		return breaksOut(s.thenBranch, label, nested) || (s.elseBranch != nil && breaksOut(s.elseBranch, label, nested))
+	case *While:
+		return breaksOut(s.body, label, true)
+	case *ForIn:
+		return breaksOut(s.body, label, true)
+	case *Select:
+		for _, sc := range s.cases {
+			if breaksOut(&Block{sc.body}, label, nested) {
+				return true
+			}
+		}
+		return s.fallback != nil && breaksOut(s.fallback, label, nested)
+	}
+	return false
+}
+
+// methodType returns how a method declared in a class or trait is resolved
+func methodType(method *Function) FunctionType {
+	if method.name.lexeme == "init" {
+		return INITIALIZER
+	}
+	return METHOD
+}
+
+// hoist defines the functions of a local scope before checking its statements,
+// like Resolver.hoist
+func (c *TypeChecker) hoist(statements []Stmt) {
+	for _, statement := range statements {
+		if f, ok := statement.(*Function); ok && isHoisted(f) {
+			c.define(f.name, c.functionType(f))
+		}
+	}
+}
+
+// functionType returns the type of the value bound to a function's name,
+// only annotated functions can't be replaced by values of other types
+func (c *TypeChecker) functionType(function *Function) Type {
+	// a decorator can replace the function with any value
+	if len(function.decorators) > 0 || !isAnnotated(function) {
+		return AnyType
+	}
+	return c.signature(function)
+}
+
+func isAnnotated(function *Function) bool {
+	for _, paramType := range function.paramTypes {
+		if paramType != (Token{}) {
+			return true
+		}
+	}
+	return function.returnType != (Token{})
+}
+
+func (c *TypeChecker) signature(function *Function) *Signature {
+	params := make([]Type, len(function.params))
+	for i := range function.params {
+		params[i] = c.resolveType(function.paramTypes[i])
+	}
+	// calling an async function returns a promise of the annotated type
+	if function.async {
+		return &Signature{params, AnyType}
+	}
+	return &Signature{params, c.resolveType(function.returnType)}
+}
+
+// resolveType returns the type named by an annotation, classes, interfaces
+// and enums declared earlier can be used as the type of their instances
+func (c *TypeChecker) resolveType(annotation Token) Type {
+	if annotation == (Token{}) {
+		return AnyType
+	}
+
+	switch t := SimpleType(annotation.lexeme); t {
+	case AnyType, NumberType, StringType, BoolType, NilType, CallableType:
+		return t
+	}
+
+	if class, ok := c.lookup(annotation).(*StaticClass); ok {
+		return InstanceType{class}
+	}
+
+	c.error(annotation, "unknown type '"+annotation.lexeme+"'")
+	return AnyType
+}
+
+func (c *TypeChecker) checkAssignable(token Token, to Type, from Type, target string) {
+	if !isAssignable(to, from) {
+		c.error(token, fmt.Sprintf("can't use '%v' as %s of type '%v'", from, target, to))
+	}
+}
+
+func (c *TypeChecker) checkNumbers(operator Token, left Type, right Type) {
+	if !isAssignable(NumberType, left) || !isAssignable(NumberType, right) {
+		c.error(operator, fmt.Sprintf("operands must be numbers but got '%v' and '%v'", left, right))
+	}
+}
+
+func (c *TypeChecker) error(token Token, message string) {
+	fmt.Println(NewParseError(token, message))
+}
+
+func (c *TypeChecker) beginScope() {
+	c.scopes = append(c.scopes, map[string]Type{})
+}
+
+func (c *TypeChecker) endScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *TypeChecker) define(name Token, t Type) {
+	if len(c.scopes) == 0 {
+		c.globals[name.lexeme] = t
+		return
+	}
+	c.scopes[len(c.scopes)-1][name.lexeme] = t
+}
+
+// isReassigned returns true if a declaration in the current scope is assigned after it
+func (c *TypeChecker) isReassigned(declaration Stmt, name Token) bool {
+	return c.resolver.isReassigned(declaration, name, len(c.scopes) == 0)
+}
+
+// lookup returns the type of a variable, variables which aren't
+// declared in checked code (e.g. natives) are Any
+func (c *TypeChecker) lookup(name Token) Type {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if t, ok := c.scopes[i][name.lexeme]; ok {
+			return t
+		}
+	}
+	if t, ok := c.globals[name.lexeme]; ok {
+		return t
+	}
+	return AnyType
+}
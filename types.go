@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+)
+
+// Type is the static type of an expression, as seen by the TypeChecker
+type Type interface {
+	String() string
+}
+
+// SimpleType is a builtin type which can be named in an annotation
+type SimpleType string
+
+const (
+	AnyType      SimpleType = "Any"
+	NumberType   SimpleType = "Number"
+	StringType   SimpleType = "String"
+	BoolType     SimpleType = "Bool"
+	NilType      SimpleType = "Nil"
+	CallableType SimpleType = "Function" // any function or class
+)
+
+func (s SimpleType) String() string {
+	return string(s)
+}
+
+// Signature is the type of a function declaration
+type Signature struct {
+	params  []Type
+	returns Type
+}
+
+func (s *Signature) String() string {
+	params := make([]string, len(s.params))
+	for i, param := range s.params {
+		params[i] = param.String()
+	}
+	return "Function(" + strings.Join(params, ", ") + "): " + s.returns.String()
+}
+
+// StaticClass is the type of a class, calling it creates an InstanceType
+// interfaces and enums are StaticClasses too so that they can be named in
+// annotations, their instances are the classes implementing them or members
+type StaticClass struct {
+	kind       string // "Class", "Interface" or "Enum"
+	name       string
+	superclass *StaticClass
+	interfaces []*StaticClass
+	fields     map[string]Type
+	methods    map[string]Type
+	setters    map[string]Type // type of the setter's parameter
+	init       *Signature
+	members    map[string]bool // of an enum
+}
+
+func NewStaticClass(name string) *StaticClass {
+	return &StaticClass{"Class", name, nil, nil, map[string]Type{}, map[string]Type{}, map[string]Type{}, nil, nil}
+}
+
+func NewStaticInterface(name string) *StaticClass {
+	iface := NewStaticClass(name)
+	iface.kind = "Interface"
+	return iface
+}
+
+// NewStaticEnum returns the type of an enum, members have a name and an ordinal
+func NewStaticEnum(name string, members []Token) *StaticClass {
+	enum := NewStaticClass(name)
+	enum.kind = "Enum"
+	enum.members = map[string]bool{}
+	for _, member := range members {
+		enum.members[member.lexeme] = true
+	}
+	enum.fields["name"] = StringType
+	enum.fields["ordinal"] = NumberType
+	return enum
+}
+
+func (s *StaticClass) String() string {
+	return s.kind + " " + s.name
+}
+
+// constructor returns the signature used for calling the class
+func (s *StaticClass) constructor() *Signature {
+	for class := s; class != nil; class = class.superclass {
+		if class.init != nil {
+			return &Signature{class.init.params, InstanceType{s}}
+		}
+	}
+	return &Signature{nil, InstanceType{s}}
+}
+
+// property returns the type of a field, getter or method, properties
+// which aren't declared are Any since they can be added at runtime
+func (s *StaticClass) property(name string) Type {
+	for class := s; class != nil; class = class.superclass {
+		if t, ok := class.fields[name]; ok {
+			return t
+		}
+		if t, ok := class.methods[name]; ok {
+			return t
+		}
+	}
+	return AnyType
+}
+
+// isSubclassOf returns true if the class is other, inherits from it or implements it
+func (s *StaticClass) isSubclassOf(other *StaticClass) bool {
+	for class := s; class != nil; class = class.superclass {
+		if class == other {
+			return true
+		}
+		for _, iface := range class.interfaces {
+			if iface == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InstanceType is the type of instances of a class, written as the class name
+type InstanceType struct {
+	class *StaticClass
+}
+
+func (i InstanceType) String() string {
+	return i.class.name
+}
+
+// isAssignable returns true if a value of type from can be used where type to is expected
+// Any is compatible with every type in both directions, which lets
+// unannotated code mix with annotated code
+func isAssignable(to Type, from Type) bool {
+	if to == AnyType || from == AnyType {
+		return true
+	}
+
+	switch t := to.(type) {
+	case SimpleType:
+		if t == CallableType {
+			switch from.(type) {
+			case *Signature, *StaticClass:
+				return true
+			}
+		}
+		return to == from
+	case *Signature:
+		if from == CallableType {
+			return true
+		}
+		f, ok := from.(*Signature)
+		if !ok || len(f.params) != len(t.params) {
+			return false
+		}
+		for i := range t.params {
+			if !isAssignable(f.params[i], t.params[i]) {
+				return false
+			}
+		}
+		return isAssignable(t.returns, f.returns)
+	case InstanceType:
+		// nil is used for instances which don't exist yet
+		if from == NilType {
+			return true
+		}
+		f, ok := from.(InstanceType)
+		return ok && f.class.isSubclassOf(t.class)
+	}
+
+	return to == from
+}
+
+// joinTypes returns the type of an expression which can produce either value
+func joinTypes(a Type, b Type) Type {
+	if isAssignable(a, b) && a != AnyType && b != AnyType {
+		return a
+	}
+	if isAssignable(b, a) && a != AnyType && b != AnyType {
+		return b
+	}
+	return AnyType
+}
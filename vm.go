@@ -0,0 +1,586 @@
+package main
+
+import (
+	"fmt"
+)
+
+// maxFrames limits the depth of calls before a stack overflow is reported
+const maxFrames = 1 << 16
+
+// VM runs the bytecode compiled from a program, it shares the globals,
+// builtins and event loop of the Interpreter the program was resolved with
+type VM struct {
+	interpreter  *Interpreter
+	stack        []interface{}
+	frames       []*callFrame
+	openUpvalues *vmUpvalue
+	tests        map[*Test]*vmFunction
+}
+
+// callFrame is a function being run, base is the stack index of its slot 0
+type callFrame struct {
+	closure *vmClosure
+	ip      int
+	base    int
+}
+
+func NewVM(interpreter *Interpreter) *VM {
+	return &VM{interpreter: interpreter}
+}
+
+func (vm *VM) Interpret(statements []Stmt) {
+	compiler := NewCompiler(vm.interpreter.globals, vm.interpreter.replMode)
+	function := compiler.compile(statements)
+	vm.tests = compiler.tests
+	if hadError {
+		return
+	}
+
+	if _, err := vm.callValue(vm.newClosure(function), nil, Token{}); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// timers continue after the main script
+	if err := vm.interpreter.loop.run(vm.interpreter); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// RunTests runs the test blocks compiled by Interpret, see Interpreter.RunTests
+func (vm *VM) RunTests(statements []Stmt) (passed, failed int) {
+	return reportTests(statements, vm.runTest)
+}
+
+func (vm *VM) runTest(test *Test) error {
+	_, err := vm.callValue(vm.newClosure(vm.tests[test]), nil, Token{})
+	if err != nil {
+		return err
+	}
+	return vm.interpreter.loop.run(vm.interpreter)
+}
+
+func (vm *VM) newClosure(function *vmFunction) *vmClosure {
+	return &vmClosure{function, make([]*vmUpvalue, len(function.upvalues)), vm}
+}
+
+func (vm *VM) push(value interface{}) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) interface{} {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// callValue calls a value from Go, it's used for calls made by natives,
+// timers, getters, setters and field initializers
+func (vm *VM) callValue(callee interface{}, args []interface{}, token Token) (interface{}, error) {
+	base := len(vm.stack)
+	depth := len(vm.frames)
+	vm.push(callee)
+	vm.stack = append(vm.stack, args...)
+
+	value, err := vm.callAndRun(len(args), token, depth)
+	if err != nil {
+		vm.closeUpvalues(base)
+		vm.stack = vm.stack[:base]
+		vm.frames = vm.frames[:depth]
+		return nil, err
+	}
+	return value, nil
+}
+
+func (vm *VM) callAndRun(argc int, token Token, depth int) (interface{}, error) {
+	if err := vm.call(argc, token); err != nil {
+		return nil, err
+	}
+	// natives and classes without an initializer return immediately
+	if len(vm.frames) == depth {
+		return vm.pop(), nil
+	}
+	return vm.run(depth)
+}
+
+// call calls the callee below the arguments on the stack, a frame is
+// pushed for closures and the result replaces the callee otherwise
+func (vm *VM) call(argc int, token Token) error {
+	slot := len(vm.stack) - argc - 1
+	switch callee := vm.stack[slot].(type) {
+	case *vmClosure:
+		return vm.callClosure(callee, slot, argc, token)
+	case *vmBoundMethod:
+		vm.stack[slot] = callee.receiver
+		return vm.callClosure(callee.method, slot, argc, token)
+	case *vmClass:
+		if err := checkArity(callee, argc, token); err != nil {
+			return err
+		}
+		instance := &vmInstance{callee, map[string]interface{}{}}
+		if err := vm.initFields(callee, instance); err != nil {
+			return err
+		}
+		vm.stack[slot] = instance
+		if initializer := callee.findMethod("init"); initializer != nil {
+			return vm.callClosure(initializer, slot, argc, token)
+		}
+		return nil
+	case LoxCallable:
+		if err := checkArity(callee, argc, token); err != nil {
+			return err
+		}
+		args := make([]interface{}, argc)
+		copy(args, vm.stack[slot+1:])
+		value, err := vm.interpreter.call(callee, token, args)
+		if err != nil {
+			return err
+		}
+		vm.stack = vm.stack[:slot]
+		vm.push(value)
+		return nil
+	}
+	return NewRuntimeError(token, "can only call functions and classes")
+}
+
+func (vm *VM) callClosure(closure *vmClosure, slot int, argc int, token Token) error {
+	if err := checkArity(closure, argc, token); err != nil {
+		return err
+	}
+	if len(vm.frames) == maxFrames {
+		return NewRuntimeError(token, "stack overflow")
+	}
+	vm.frames = append(vm.frames, &callFrame{closure, 0, slot})
+	return nil
+}
+
+// initFields sets declared fields to their default values, starting with
+// the ones inherited from the superclass like LoxClass.initFields
+func (vm *VM) initFields(class *vmClass, instance *vmInstance) error {
+	if class.superclass != nil {
+		if err := vm.initFields(class.superclass, instance); err != nil {
+			return err
+		}
+	}
+	for _, field := range class.fields {
+		var value interface{}
+		if field.initializer != nil {
+			v, err := vm.callValue(&vmBoundMethod{instance, field.initializer}, nil, Token{})
+			if err != nil {
+				return err
+			}
+			value = v
+		}
+		instance.fields[field.name] = value
+	}
+	return nil
+}
+
+// run runs instructions until the frame at the given depth returns
+func (vm *VM) run(depth int) (interface{}, error) {
+	frame := vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.function.chunk
+
+	readByte := func() byte {
+		frame.ip++
+		return chunk.code[frame.ip-1]
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return chunk.readShort(frame.ip - 2)
+	}
+	// instructions take the token of their opcode
+	token := func() Token {
+		return chunk.tokens[frame.ip-1]
+	}
+
+	for {
+		switch OpCode(readByte()) {
+		case OP_CONSTANT:
+			vm.push(chunk.constants[readShort()])
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.pop()
+		case OP_UNWIND:
+			top := len(vm.stack) - readShort()
+			vm.closeUpvalues(top)
+			vm.stack = vm.stack[:top]
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.base+readShort()])
+		case OP_SET_LOCAL:
+			vm.stack[frame.base+readShort()] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			value, err := vm.interpreter.globals.get(readShort(), token())
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			index := readShort()
+			vm.interpreter.globals.put(index, vm.pop())
+		case OP_SET_GLOBAL:
+			if err := vm.interpreter.globals.assign(readShort(), token(), vm.peek(0)); err != nil {
+				return nil, err
+			}
+		case OP_GET_UPVALUE:
+			upvalue := frame.closure.upvalues[readShort()]
+			if upvalue.open {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case OP_SET_UPVALUE:
+			upvalue := frame.closure.upvalues[readShort()]
+			if upvalue.open {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+		case OP_GET_PROPERTY:
+			readShort()
+			value, err := vm.getProperty(vm.peek(0), token())
+			if err != nil {
+				return nil, err
+			}
+			vm.stack[len(vm.stack)-1] = value
+		case OP_CHECK_INSTANCE:
+			switch vm.peek(0).(type) {
+			case *vmInstance, *LoxInstance:
+			default:
+				return nil, NewRuntimeError(token(), "only instances have fields")
+			}
+		case OP_SET_PROPERTY:
+			readShort()
+			value := vm.pop()
+			if err := vm.setProperty(vm.pop(), token(), value); err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_GET_SUPER:
+			name := chunk.constants[readShort()].(string)
+			superclass := vm.pop().(*vmClass)
+			value, err := vm.getSuper(vm.pop(), superclass, name, token())
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_BINARY:
+			readByte()
+			right := vm.pop()
+			value, err := vm.binary(token(), vm.pop(), right)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_NOT:
+			vm.stack[len(vm.stack)-1] = !isTruthy(vm.peek(0))
+		case OP_NEGATE:
+			if err := checkNumberOperand(token(), vm.peek(0)); err != nil {
+				return nil, err
+			}
+			vm.stack[len(vm.stack)-1] = -vm.peek(0).(float64)
+		case OP_SLICE_BOUND:
+			if _, err := sliceBound(token(), vm.peek(0)); err != nil {
+				return nil, err
+			}
+		case OP_SLICE:
+			value, err := vm.slice(token())
+			if err != nil {
+				return nil, err
+			}
+			vm.push(value)
+		case OP_PRINT:
+			fmt.Println(stringify(vm.pop()))
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argc := int(readByte())
+			if err := vm.call(argc, token()); err != nil {
+				return nil, err
+			}
+			frame = vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case OP_CLOSURE:
+			function := chunk.constants[readShort()].(*vmFunction)
+			closure := vm.newClosure(function)
+			for j, upvalue := range function.upvalues {
+				if upvalue.isLocal {
+					closure.upvalues[j] = vm.captureUpvalue(frame.base + upvalue.index)
+				} else {
+					closure.upvalues[j] = frame.closure.upvalues[upvalue.index]
+				}
+			}
+			vm.push(closure)
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == depth {
+				return result, nil
+			}
+			vm.push(result)
+			frame = vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case OP_CLASS:
+			name := chunk.constants[readShort()].(string)
+			var superclass *vmClass
+			if readByte() == 1 {
+				class, ok := vm.pop().(*vmClass)
+				if !ok {
+					return nil, NewRuntimeError(token(), "superclass must be a class")
+				}
+				superclass = class
+			}
+			vm.push(newVMClass(name, superclass, vm))
+		case OP_METHOD:
+			name := chunk.constants[readShort()].(string)
+			vm.peek(1).(*vmClass).methods[name] = vm.pop().(*vmClosure)
+		case OP_GETTER:
+			name := chunk.constants[readShort()].(string)
+			vm.peek(1).(*vmClass).getters[name] = vm.pop().(*vmClosure)
+		case OP_SETTER:
+			name := chunk.constants[readShort()].(string)
+			vm.peek(1).(*vmClass).setters[name] = vm.pop().(*vmClosure)
+		case OP_FIELD:
+			name := chunk.constants[readShort()].(string)
+			var initializer *vmClosure
+			if readByte() == 1 {
+				initializer = vm.pop().(*vmClosure)
+			}
+			class := vm.peek(0).(*vmClass)
+			class.fields = append(class.fields, vmField{name, initializer})
+		case OP_RECORD:
+			stmt := chunk.constants[readShort()].(*Record)
+			empty := map[string]LoxFunction{}
+			class := NewLoxClass(stmt.name.lexeme, nil, empty, empty, empty, map[string]int{}, nil, nil)
+			class.record = stmt
+			vm.push(class)
+		case OP_ENUM:
+			stmt := chunk.constants[readShort()].(*Enum)
+			vm.push(NewLoxEnum(stmt.name.lexeme, stmt.members))
+		case OP_ITERATOR:
+			iterable, ok := vm.peek(0).(LoxIterable)
+			if !ok {
+				return nil, NewRuntimeError(token(), "can only iterate over enums")
+			}
+			vm.stack[len(vm.stack)-1] = iterable.iterator()
+		case OP_FOR_NEXT:
+			offset := readShort()
+			next := vm.peek(0).(func() (interface{}, bool))
+			if value, ok := next(); ok {
+				vm.push(value)
+			} else {
+				frame.ip += offset
+			}
+		case OP_ASSERT:
+			stmt := chunk.constants[readShort()].(*Assert)
+			offset := readShort()
+			holds, values, err := vm.assert(stmt)
+			if err != nil {
+				return nil, err
+			}
+			if holds {
+				frame.ip += offset
+			} else {
+				vm.push(values)
+			}
+		case OP_ASSERT_FAIL:
+			stmt := chunk.constants[readShort()].(*Assert)
+			var message interface{}
+			if stmt.message != nil {
+				message = vm.pop()
+			}
+			msg := "assertion failed: " + stmt.source + " (" + vm.pop().(string) + ")"
+			if stmt.message != nil {
+				msg += ": " + stringify(message)
+			}
+			return nil, NewRuntimeError(stmt.keyword, msg)
+		}
+	}
+}
+
+// assert pops the values of an assert statement's condition and returns
+// whether it holds along with the values shown when it doesn't
+func (vm *VM) assert(stmt *Assert) (bool, string, error) {
+	if b, ok := stmt.condition.(*Binary); ok {
+		right := vm.pop()
+		left := vm.pop()
+		value, err := vm.binary(b.operator, left, right)
+		if err != nil {
+			return false, "", err
+		}
+		return isTruthy(value), assertedValue(left) + " " + b.operator.lexeme + " " + assertedValue(right), nil
+	}
+	value := vm.pop()
+	return isTruthy(value), assertedValue(value), nil
+}
+
+func (vm *VM) binary(operator Token, left interface{}, right interface{}) (interface{}, error) {
+	switch operator.typ {
+	case EQUAL_EQUAL, BANG_EQUAL:
+		equal, err := vm.equals(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return equal == (operator.typ == EQUAL_EQUAL), nil
+	case IS:
+		switch class := right.(type) {
+		case *vmClass:
+			instance, ok := left.(*vmInstance)
+			return ok && instance.class.isSubclassOf(class), nil
+		case *LoxClass:
+			instance, ok := left.(*LoxInstance)
+			return ok && instance.class.isSubclassOf(class), nil
+		}
+		return nil, NewRuntimeError(operator, "right operand of 'is' must be a class")
+	}
+	return arithmetic(operator, left, right)
+}
+
+// equals implements ==, a class can override it with an equals(other) method
+func (vm *VM) equals(a interface{}, b interface{}) (bool, error) {
+	if l, ok := a.(*vmInstance); ok {
+		if method := l.class.findMethod("equals"); method != nil && method.arity() == 1 {
+			value, err := vm.callValue(&vmBoundMethod{l, method}, []interface{}{b}, Token{})
+			return isTruthy(value), err
+		}
+	}
+	return isEqual(a, b), nil
+}
+
+func (vm *VM) getProperty(object interface{}, name Token) (interface{}, error) {
+	switch v := object.(type) {
+	case *vmInstance:
+		if value, ok := v.fields[name.lexeme]; ok {
+			return value, nil
+		}
+		// getters run on property access
+		if getter := v.class.findGetter(name.lexeme); getter != nil {
+			return vm.callValue(&vmBoundMethod{v, getter}, nil, name)
+		}
+		if method := v.class.findMethod(name.lexeme); method != nil {
+			return &vmBoundMethod{v, method}, nil
+		}
+		return nil, NewRuntimeError(name, "undefined property '"+name.lexeme+"'.")
+	case *LoxInstance:
+		return v.get(vm.interpreter, name)
+	case *LoxEnum:
+		return v.get(name)
+	case *LoxEnumMember:
+		return v.get(name)
+	}
+
+	if builtin, ok := vm.interpreter.builtins[builtinTypeName(object)]; ok {
+		return builtin.get(object, name)
+	}
+
+	return nil, NewRuntimeError(name, "only instances have properties")
+}
+
+func (vm *VM) setProperty(object interface{}, name Token, value interface{}) error {
+	v, ok := object.(*vmInstance)
+	if !ok {
+		return object.(*LoxInstance).set(vm.interpreter, name, value)
+	}
+
+	if setter := v.class.findSetter(name.lexeme); setter != nil {
+		_, err := vm.callValue(&vmBoundMethod{v, setter}, []interface{}{value}, name)
+		return err
+	}
+
+	// a getter without a matching setter makes the property read-only
+	if v.class.findGetter(name.lexeme) != nil {
+		return NewRuntimeError(name, "can't set read-only property '"+name.lexeme+"'.")
+	}
+
+	v.fields[name.lexeme] = value
+	return nil
+}
+
+func (vm *VM) getSuper(object interface{}, superclass *vmClass, name string, token Token) (interface{}, error) {
+	method := superclass.findMethod(name)
+	if method == nil {
+		if getter := superclass.findGetter(name); getter != nil {
+			return vm.callValue(&vmBoundMethod{object, getter}, nil, token)
+		}
+		msg := fmt.Sprintf("undefined property %q", name)
+		return nil, NewRuntimeError(token, msg)
+	}
+	return &vmBoundMethod{object, method}, nil
+}
+
+// slice pops the object and bounds of a slice expression, the bounds
+// have been checked by OP_SLICE_BOUND
+func (vm *VM) slice(bracket Token) (interface{}, error) {
+	var bounds [3]*int
+	for j := 2; j >= 0; j-- {
+		bounds[j], _ = sliceBound(bracket, vm.pop())
+	}
+	object := vm.pop()
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+
+	if step != nil && *step == 0 {
+		return nil, NewRuntimeError(bracket, "slice step can't be zero")
+	}
+
+	str, ok := object.(string)
+	if !ok {
+		return nil, NewRuntimeError(bracket, "only strings can be sliced")
+	}
+	return sliceString(str, start, stop, step), nil
+}
+
+// captureUpvalue returns the open upvalue of a stack slot, closures
+// capturing the same variable share it
+func (vm *VM) captureUpvalue(slot int) *vmUpvalue {
+	var previous *vmUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &vmUpvalue{slot: slot, open: true, next: upvalue}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves the variables from the given slot upwards off the stack
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		// hoisted functions capture the locals declared after them before
+		// they're pushed, such a variable is nil if it's never declared
+		if upvalue.slot < len(vm.stack) {
+			upvalue.closed = vm.stack[upvalue.slot]
+		}
+		upvalue.open = false
+		vm.openUpvalues = upvalue.next
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+// vmFunction is a function compiled to bytecode, closures are created
+// from it at runtime by capturing the variables listed in upvalues
+type vmFunction struct {
+	name     string
+	arity    int
+	chunk    Chunk
+	upvalues []upvalueRef
+	isInit   bool
+}
+
+// upvalueRef is a variable captured by a closure, either a local of the
+// enclosing function or one of the enclosing closure's own upvalues
+type upvalueRef struct {
+	isLocal bool
+	index   int
+}
+
+// vmClosure implements LoxCallable
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+	vm       *VM // for calls made by natives and timers
+}
+
+func (c *vmClosure) arity() int {
+	return c.function.arity
+}
+
+func (c *vmClosure) call(_ *Interpreter, args []interface{}) (interface{}, error) {
+	return c.vm.callValue(c, args, Token{})
+}
+
+func (c *vmClosure) String() string {
+	return "<fn " + c.function.name + ">"
+}
+
+// vmUpvalue is a variable captured by closures, it refers to a slot of
+// the stack until the variable goes out of scope and is then closed over
+type vmUpvalue struct {
+	slot   int
+	open   bool
+	closed interface{}
+	next   *vmUpvalue // open upvalues are kept sorted by slot, highest first
+}
+
+// vmClass implements LoxCallable, members are looked up through the
+// superclasses like LoxClass does
+type vmClass struct {
+	name       string
+	superclass *vmClass
+	methods    map[string]*vmClosure
+	getters    map[string]*vmClosure
+	setters    map[string]*vmClosure
+	fields     []vmField
+	vm         *VM
+}
+
+// vmField is a declared field, initializer is nil for fields without one
+type vmField struct {
+	name        string
+	initializer *vmClosure
+}
+
+func newVMClass(name string, superclass *vmClass, vm *VM) *vmClass {
+	return &vmClass{name, superclass, map[string]*vmClosure{}, map[string]*vmClosure{}, map[string]*vmClosure{}, nil, vm}
+}
+
+func (c *vmClass) arity() int {
+	if initializer := c.findMethod("init"); initializer != nil {
+		return initializer.arity()
+	}
+	return 0
+}
+
+func (c *vmClass) call(_ *Interpreter, args []interface{}) (interface{}, error) {
+	return c.vm.callValue(c, args, Token{})
+}
+
+func (c *vmClass) findMethod(name string) *vmClosure {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func (c *vmClass) findGetter(name string) *vmClosure {
+	for class := c; class != nil; class = class.superclass {
+		if getter, ok := class.getters[name]; ok {
+			return getter
+		}
+	}
+	return nil
+}
+
+func (c *vmClass) findSetter(name string) *vmClosure {
+	for class := c; class != nil; class = class.superclass {
+		if setter, ok := class.setters[name]; ok {
+			return setter
+		}
+	}
+	return nil
+}
+
+func (c *vmClass) isSubclassOf(other *vmClass) bool {
+	for class := c; class != nil; class = class.superclass {
+		if class == other {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *vmClass) String() string {
+	return c.name
+}
+
+type vmInstance struct {
+	class  *vmClass
+	fields map[string]interface{}
+}
+
+func (i *vmInstance) String() string {
+	return i.class.name + " instance"
+}
+
+// vmBoundMethod implements LoxCallable, the receiver is put in slot 0 when it's called
+type vmBoundMethod struct {
+	receiver interface{}
+	method   *vmClosure
+}
+
+func (b *vmBoundMethod) arity() int {
+	return b.method.arity()
+}
+
+func (b *vmBoundMethod) call(_ *Interpreter, args []interface{}) (interface{}, error) {
+	return b.method.vm.callValue(b, args, Token{})
+}
+
+func (b *vmBoundMethod) String() string {
+	return b.method.String()
+}